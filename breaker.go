@@ -0,0 +1,131 @@
+package sreq
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// CircuitBreaker is the interface that decides whether a request is allowed to be sent,
+	// and records the result of each request allowed.
+	CircuitBreaker interface {
+		// Allow reports whether a request is allowed to be sent.
+		Allow() bool
+
+		// Success records a successful request.
+		Success()
+
+		// Failure records a failed request, i.e. a transport error or a 5xx status code.
+		Failure()
+	}
+
+	// hostCircuitBreaker is implemented by a circuit breaker which keeps separate states for each host.
+	hostCircuitBreaker interface {
+		forHost(host string) CircuitBreaker
+	}
+
+	rollingCircuitBreaker struct {
+		threshold int
+		window    time.Duration
+		cooldown  time.Duration
+		mu        sync.Mutex
+		hosts     map[string]*circuitState
+	}
+
+	circuitState struct {
+		cb       *rollingCircuitBreaker
+		failures []time.Time
+		open     bool
+		probing  bool
+		openedAt time.Time
+	}
+)
+
+// NewCircuitBreaker returns a rolling-window circuit breaker keyed by host when used by a client.
+// The circuit of a host opens once threshold failures occur within window, and rejects requests
+// for cooldown. After that a single trial request is allowed, the circuit closes if it succeeds,
+// or opens again otherwise.
+func NewCircuitBreaker(threshold int, window time.Duration, cooldown time.Duration) CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &rollingCircuitBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		hosts:     make(map[string]*circuitState),
+	}
+}
+
+func (cb *rollingCircuitBreaker) forHost(host string) CircuitBreaker {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cs, ok := cb.hosts[host]
+	if !ok {
+		cs = &circuitState{cb: cb}
+		cb.hosts[host] = cs
+	}
+	return cs
+}
+
+// Allow implements the Allow method of the CircuitBreaker interface, shared by all hosts.
+func (cb *rollingCircuitBreaker) Allow() bool {
+	return cb.forHost("").Allow()
+}
+
+// Success implements the Success method of the CircuitBreaker interface, shared by all hosts.
+func (cb *rollingCircuitBreaker) Success() {
+	cb.forHost("").Success()
+}
+
+// Failure implements the Failure method of the CircuitBreaker interface, shared by all hosts.
+func (cb *rollingCircuitBreaker) Failure() {
+	cb.forHost("").Failure()
+}
+
+func (cs *circuitState) Allow() bool {
+	cs.cb.mu.Lock()
+	defer cs.cb.mu.Unlock()
+
+	if !cs.open {
+		return true
+	}
+	if cs.probing || time.Since(cs.openedAt) < cs.cb.cooldown {
+		return false
+	}
+
+	cs.probing = true
+	return true
+}
+
+func (cs *circuitState) Success() {
+	cs.cb.mu.Lock()
+	defer cs.cb.mu.Unlock()
+
+	cs.failures = nil
+	cs.open, cs.probing = false, false
+}
+
+func (cs *circuitState) Failure() {
+	cs.cb.mu.Lock()
+	defer cs.cb.mu.Unlock()
+
+	now := time.Now()
+	if cs.open {
+		cs.probing = false
+		cs.openedAt = now
+		return
+	}
+
+	i := 0
+	for i < len(cs.failures) && now.Sub(cs.failures[i]) >= cs.cb.window {
+		i++
+	}
+	cs.failures = append(cs.failures[i:], now)
+	if len(cs.failures) >= cs.cb.threshold {
+		cs.failures = nil
+		cs.open = true
+		cs.openedAt = now
+	}
+}
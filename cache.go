@@ -0,0 +1,220 @@
+package sreq
+
+import (
+	"bytes"
+	"container/list"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Cache is the interface that stores the HTTP responses for the client, keyed by URL.
+	// It must be safe for concurrent use.
+	Cache interface {
+		// Get returns the entry stored for key.
+		Get(key string) (*CacheEntry, bool)
+
+		// Set stores entry for key.
+		Set(key string, entry *CacheEntry)
+
+		// Delete deletes the entry stored for key.
+		Delete(key string)
+	}
+
+	// CacheEntry is a cached HTTP response.
+	// An entry is fresh until Expires, then it will be revalidated using its ETag, if any.
+	// Vary records the request header values named by the Vary header of the response,
+	// the entry is only used for the requests having the same values.
+	// ReceivedAt is the time when the response was received, used by Response.ClockSkew.
+	CacheEntry struct {
+		StatusCode int
+		Header     http.Header
+		Body       []byte
+		Expires    time.Time
+		Vary       http.Header
+		ReceivedAt time.Time
+	}
+
+	lruCache struct {
+		capacity int
+		mu       sync.Mutex
+		ll       *list.List
+		items    map[string]*list.Element
+	}
+
+	lruItem struct {
+		key   string
+		entry *CacheEntry
+	}
+)
+
+// NewLRUCache returns an in-memory Cache which holds at most capacity entries,
+// the least recently used one will be evicted once it's full.
+// If capacity <= 0, the number of entries is unlimited.
+func NewLRUCache(capacity int) Cache {
+	return &lruCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get implements the Get method of the Cache interface.
+func (c *lruCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruItem).entry, true
+}
+
+// Set implements the Set method of the Cache interface.
+func (c *lruCache) Set(key string, entry *CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*lruItem).entry = entry
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruItem{key: key, entry: entry})
+	if c.capacity > 0 && c.ll.Len() > c.capacity {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*lruItem).key)
+	}
+}
+
+// Delete implements the Delete method of the Cache interface.
+func (c *lruCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.ll.Remove(e)
+		delete(c.items, key)
+	}
+}
+
+// fresh reports whether entry can be used without revalidation.
+func (entry *CacheEntry) fresh() bool {
+	return time.Now().Before(entry.Expires)
+}
+
+// matches reports whether entry can be used for a request with header h, according to entry.Vary.
+func (entry *CacheEntry) matches(h http.Header) bool {
+	for k, vs := range entry.Vary {
+		if strings.Join(h[k], ",") != strings.Join(vs, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// response returns an HTTP response built from entry, whose body is independently readable.
+func (entry *CacheEntry) response(rawRequest *http.Request) (*http.Response, []byte) {
+	body := append([]byte(nil), entry.Body...)
+	return &http.Response{
+		Status:        strconv.Itoa(entry.StatusCode) + " " + http.StatusText(entry.StatusCode),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cloneHeader(entry.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       rawRequest,
+	}, body
+}
+
+// cacheControl parses the directives of Cache-Control header value, the keys are in lower case.
+func cacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, v := range h["Cache-Control"] {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			k, v := directive, ""
+			if i := strings.IndexByte(directive, '='); i >= 0 {
+				k, v = directive[:i], strings.Trim(directive[i+1:], `"`)
+			}
+			directives[strings.ToLower(k)] = v
+		}
+	}
+	return directives
+}
+
+// cacheExpires returns the time until which a response with header h is fresh,
+// ok reports whether the response is allowed to be stored.
+func cacheExpires(h http.Header) (expires time.Time, ok bool) {
+	directives := cacheControl(h)
+	if _, noStore := directives["no-store"]; noStore {
+		return time.Time{}, false
+	}
+
+	now := time.Now()
+	if _, noCache := directives["no-cache"]; noCache {
+		return now, true
+	}
+	if v, exists := directives["max-age"]; exists {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+			return now.Add(time.Duration(seconds) * time.Second), true
+		}
+		return now, true
+	}
+	if v := h.Get("Expires"); v != "" {
+		if t, err := http.ParseTime(v); err == nil {
+			return t, true
+		}
+	}
+	return now, true
+}
+
+// cacheVary returns the values of reqHeader named by the Vary header of respHeader,
+// ok reports whether the response can be stored, i.e. it's not "Vary: *".
+func cacheVary(reqHeader http.Header, respHeader http.Header) (vary http.Header, ok bool) {
+	for _, v := range respHeader["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, false
+			}
+			if vary == nil {
+				vary = make(http.Header)
+			}
+			name = http.CanonicalHeaderKey(name)
+			vary[name] = append([]string(nil), reqHeader[name]...)
+		}
+	}
+	return vary, true
+}
+
+// cacheShareable reports whether a response with header h can be stored and served to other requests.
+// A private response is never stored, and the response to a request with credentials,
+// i.e. Authorization header or cookies, is only stored if it's explicitly public.
+func cacheShareable(h http.Header, credentialed bool) bool {
+	directives := cacheControl(h)
+	if _, private := directives["private"]; private {
+		return false
+	}
+	if _, public := directives["public"]; credentialed && !public {
+		return false
+	}
+	return true
+}
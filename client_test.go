@@ -1,19 +1,37 @@
 package sreq_test
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/winterssy/sreq"
+	"golang.org/x/net/http2"
 	"golang.org/x/net/publicsuffix"
 )
 
@@ -122,6 +140,120 @@ func TestClient_SetProxyFromURL(t *testing.T) {
 	}
 }
 
+func serveSOCKS5(t *testing.T, username string, password string) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handle := func(conn net.Conn) {
+		defer conn.Close()
+
+		buf := make([]byte, 256)
+		// greeting: VER NMETHODS METHODS
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+			return
+		}
+		conn.Write([]byte{0x05, 0x02})
+
+		// username/password authentication: VER ULEN UNAME PLEN PASSWD
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		uname := make([]byte, buf[1])
+		io.ReadFull(conn, uname)
+		io.ReadFull(conn, buf[:1])
+		passwd := make([]byte, buf[0])
+		io.ReadFull(conn, passwd)
+		if string(uname) != username || string(passwd) != password {
+			conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		conn.Write([]byte{0x01, 0x00})
+
+		// request: VER CMD RSV ATYP DST.ADDR DST.PORT
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+			return
+		}
+		var host string
+		switch buf[3] {
+		case 0x01:
+			io.ReadFull(conn, buf[:4])
+			host = net.IP(buf[:4]).String()
+		case 0x03:
+			io.ReadFull(conn, buf[:1])
+			domain := make([]byte, buf[0])
+			io.ReadFull(conn, domain)
+			host = string(domain)
+		default:
+			return
+		}
+		io.ReadFull(conn, buf[:2])
+		port := int(buf[0])<<8 | int(buf[1])
+
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		defer target.Close()
+		conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+
+		go io.Copy(target, conn)
+		io.Copy(conn, target)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+func TestClient_SetProxyFromURLWithSOCKS5Auth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	addr, closeProxy := serveSOCKS5(t, "admin", "pass")
+	defer closeProxy()
+
+	data, err := sreq.New().
+		SetProxyFromURL("socks5://admin:pass@" + addr).
+		Get(ts.URL).
+		EnsureStatusOk().
+		Text()
+	if err != nil || data != "hello world" {
+		t.Errorf("Client_SetProxyFromURLWithSOCKS5Auth got: %q, want: %q", data, "hello world")
+	}
+
+	_, err = sreq.New().
+		SetProxyFromURL("socks5h://admin:wrong@" + addr).
+		Get(ts.URL).
+		Raw()
+	if err == nil {
+		t.Error("Client_SetProxyFromURLWithSOCKS5Auth test failed")
+	}
+
+	_, err = sreq.New().
+		SetTransport(nil).
+		SetProxyFromURL("socks5://admin:pass@" + addr).
+		Raw()
+	if _, ok := err.(*sreq.ClientError); !ok {
+		t.Error("Client_SetProxyFromURLWithSOCKS5Auth test failed")
+	}
+}
+
 func TestClient_DisableProxy(t *testing.T) {
 	rawClient, err := sreq.New().DisableProxy().Raw()
 	if err != nil {
@@ -134,6 +266,52 @@ func TestClient_DisableProxy(t *testing.T) {
 	}
 }
 
+func TestClient_SetProxySelector(t *testing.T) {
+	newProxy := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	proxy1, proxy2 := newProxy("proxy1"), newProxy("proxy2")
+	defer proxy1.Close()
+	defer proxy2.Close()
+
+	selector := func(req *sreq.Request) (*url.URL, error) {
+		switch req.RawRequest.Header.Get("X-Route") {
+		case "1":
+			return url.Parse(proxy1.URL)
+		case "2":
+			return url.Parse(proxy2.URL)
+		default:
+			return nil, errors.New("no proxy available")
+		}
+	}
+
+	client := sreq.New().SetProxySelector(selector)
+	for route, want := range map[string]string{"1": "proxy1", "2": "proxy2"} {
+		data, err := client.
+			Get("http://sreq.example.com",
+				sreq.WithHeaders(sreq.Headers{
+					"X-Route": route,
+				}),
+			).
+			Text()
+		if err != nil || data != want {
+			t.Errorf("Client_SetProxySelector got: %q, want: %q, error: %v", data, want, err)
+		}
+	}
+
+	_, err := client.Get("http://sreq.example.com").Raw()
+	if err == nil {
+		t.Error("Client_SetProxySelector test failed")
+	}
+
+	_, err = sreq.New().SetTransport(nil).SetProxySelector(selector).Raw()
+	if err == nil {
+		t.Error("Client_SetProxySelector test failed")
+	}
+}
+
 func TestClient_SetTLSClientConfig(t *testing.T) {
 	config := &tls.Config{}
 
@@ -147,75 +325,907 @@ func TestClient_SetTLSClientConfig(t *testing.T) {
 		t.Error("Client_SetTLSClientConfig test failed")
 	}
 
-	rawClient, err = sreq.New().SetTransport(nil).SetTLSClientConfig(config).Raw()
-	if err == nil {
-		t.Error("Client_SetTLSClientConfig test failed")
+	rawClient, err = sreq.New().SetTransport(nil).SetTLSClientConfig(config).Raw()
+	if err == nil {
+		t.Error("Client_SetTLSClientConfig test failed")
+	}
+}
+
+func TestClient_AppendClientCertificates(t *testing.T) {
+	cert := tls.Certificate{}
+
+	rawClient, err := sreq.New().AppendClientCertificates(cert).Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport, ok := rawClient.Transport.(*http.Transport)
+	if !ok || transport == nil || transport.TLSClientConfig == nil ||
+		len(transport.TLSClientConfig.Certificates) != 1 {
+		t.Fatal("Client_AppendClientCertificates test failed")
+	}
+
+	rawClient, err = sreq.New().SetTransport(nil).AppendClientCertificates(cert).Raw()
+	if err == nil {
+		t.Error("Client_AppendClientCertificates test failed")
+	}
+}
+
+func TestClient_AppendClientCertFromFile(t *testing.T) {
+	const (
+		certFile = "./testdata/client-cert.pem"
+		keyFile  = "./testdata/client-key.pem"
+	)
+
+	rawClient, err := sreq.New().AppendClientCertFromFile(certFile, keyFile).Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := rawClient.Transport.(*http.Transport)
+	if transport.TLSClientConfig == nil || len(transport.TLSClientConfig.Certificates) != 1 {
+		t.Error("Client_AppendClientCertFromFile test failed")
+	}
+
+	_, err = sreq.New().AppendClientCertFromFile("./testdata/not-exist.pem", keyFile).Raw()
+	if err == nil {
+		t.Error("Client_AppendClientCertFromFile test failed")
+	}
+
+	_, err = sreq.New().AppendClientCertFromFile(certFile, "./testdata/root-ca.pem").Raw()
+	if err == nil {
+		t.Error("Client_AppendClientCertFromFile test failed")
+	}
+}
+
+func TestClient_AppendRootCAs(t *testing.T) {
+	const (
+		pemFileExist    = "./testdata/root-ca.pem"
+		pemFileNotExist = "./testdata/root-ca-not-exist.pem"
+	)
+
+	rawClient, err := sreq.New().AppendRootCAs(pemFileExist).Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport, ok := rawClient.Transport.(*http.Transport)
+	if !ok || transport == nil || transport.TLSClientConfig == nil ||
+		transport.TLSClientConfig.RootCAs == nil {
+		t.Error("Client_AppendRootCAs test failed")
+	}
+
+	rawClient, err = sreq.New().AppendRootCAs(pemFileNotExist).Raw()
+	if err == nil {
+		t.Error("Client_AppendRootCAs test failed")
+	}
+
+	rawClient, err = sreq.New().SetTransport(nil).AppendRootCAs(pemFileExist).Raw()
+	if err == nil {
+		t.Error("Client_AppendRootCAs test failed")
+	}
+}
+
+func TestClient_DisableVerify(t *testing.T) {
+	rawClient, err := sreq.New().SetTransport(nil).DisableVerify().Raw()
+	if err == nil {
+		t.Error("Client_DisableVerify test failed")
+	}
+
+	rawClient, err = sreq.New().DisableVerify().Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport, ok := rawClient.Transport.(*http.Transport)
+	if !ok || transport == nil || transport.TLSClientConfig == nil ||
+		!transport.TLSClientConfig.InsecureSkipVerify {
+		t.Error("Client_DisableVerify test failed")
+	}
+}
+
+func TestClient_SetMaxResponseHeaderBytes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Large", strings.Repeat("a", 8<<10))
+	}))
+	defer ts.Close()
+
+	_, err := sreq.New().SetTransport(nil).SetMaxResponseHeaderBytes(4 << 10).Raw()
+	if err == nil {
+		t.Error("Client_SetMaxResponseHeaderBytes test failed")
+	}
+
+	client := sreq.New().SetMaxResponseHeaderBytes(4 << 10)
+	rawClient, err := client.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, ok := rawClient.Transport.(*http.Transport)
+	if !ok || transport.MaxResponseHeaderBytes != 4<<10 {
+		t.Error("Client_SetMaxResponseHeaderBytes test failed")
+	}
+
+	_, err = client.Get(ts.URL).Raw()
+	if err == nil {
+		t.Error("Client_SetMaxResponseHeaderBytes test failed")
+	}
+}
+
+func TestClient_SetMaxConnsPerHost(t *testing.T) {
+	rawClient, err := sreq.New().
+		SetMaxIdleConns(200).
+		SetMaxIdleConnsPerHost(20).
+		SetMaxConnsPerHost(50).
+		Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := rawClient.Transport.(*http.Transport)
+	if transport.MaxIdleConns != 200 || transport.MaxIdleConnsPerHost != 20 || transport.MaxConnsPerHost != 50 {
+		t.Error("Client_SetMaxConnsPerHost test failed")
+	}
+
+	for _, client := range []*sreq.Client{
+		sreq.New().SetTransport(nil).SetMaxIdleConns(200),
+		sreq.New().SetTransport(nil).SetMaxIdleConnsPerHost(20),
+		sreq.New().SetTransport(nil).SetMaxConnsPerHost(50),
+	} {
+		if _, err = client.Raw(); err == nil {
+			t.Error("Client_SetMaxConnsPerHost test failed")
+		}
+	}
+}
+
+func TestClient_SetBufferSize(t *testing.T) {
+	rawClient, err := sreq.New().
+		SetWriteBufferSize(64 << 10).
+		SetReadBufferSize(32 << 10).
+		Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := rawClient.Transport.(*http.Transport)
+	if transport.WriteBufferSize != 64<<10 || transport.ReadBufferSize != 32<<10 {
+		t.Error("Client_SetBufferSize test failed")
+	}
+
+	_, err = sreq.New().SetTransport(nil).SetWriteBufferSize(64 << 10).Raw()
+	if err == nil {
+		t.Error("Client_SetBufferSize test failed")
+	}
+}
+
+func TestClient_SetWriteTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+	}))
+	defer ts.Close()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("hello world"))
+
+	client := sreq.New().SetWriteTimeout(100 * time.Millisecond)
+	start := time.Now()
+	_, err := client.
+		Post(ts.URL,
+			sreq.WithBody(pr),
+		).
+		Raw()
+	if err != sreq.ErrWriteTimeout {
+		t.Fatalf("Client_SetWriteTimeout got: %v, want: %v", err, sreq.ErrWriteTimeout)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("Client_SetWriteTimeout test failed")
+	}
+
+	data, err := client.
+		Post(ts.URL,
+			sreq.WithText("hello world"),
+		).
+		EnsureStatusOk().
+		Text()
+	if err != nil || data != "" {
+		t.Error("Client_SetWriteTimeout test failed")
+	}
+}
+
+func TestClient_SetConnReadDeadline(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	stall := make(chan struct{})
+	defer close(stall)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				<-stall
+			}()
+		}
+	}()
+
+	_, err = sreq.New().SetTransport(nil).SetConnReadDeadline(100 * time.Millisecond).Raw()
+	if err == nil {
+		t.Error("Client_SetConnReadDeadline test failed")
+	}
+
+	client := sreq.New().
+		SetTimeout(10 * time.Second).
+		SetConnReadDeadline(100 * time.Millisecond).
+		SetConnWriteDeadline(100 * time.Millisecond)
+	start := time.Now()
+	err = client.Get("http://" + ln.Addr().String()).Error()
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Fatalf("Client_SetConnReadDeadline got: %v, want a timeout error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Client_SetConnReadDeadline took: %s, want less than 2s", elapsed)
+	}
+}
+
+func TestClient_SetConnDeadlineWithSOCKS5Proxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	stall := make(chan struct{})
+	defer close(stall)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// Complete the SOCKS5 handshake with username/password authentication, then stall.
+				buf := make([]byte, 512)
+				io.ReadFull(conn, buf[:2])
+				io.ReadFull(conn, buf[:buf[1]])
+				conn.Write([]byte{5, 2})
+				io.ReadFull(conn, buf[:2])
+				io.ReadFull(conn, buf[:buf[1]+1])
+				io.ReadFull(conn, buf[:buf[buf[1]]])
+				conn.Write([]byte{1, 0})
+				io.ReadFull(conn, buf[:4])
+				if buf[3] == 1 {
+					io.ReadFull(conn, buf[:6])
+				} else {
+					io.ReadFull(conn, buf[:1])
+					io.ReadFull(conn, buf[:buf[0]+2])
+				}
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				<-stall
+			}()
+		}
+	}()
+
+	// The deadline set before the SOCKS5 proxy applies to the connections dialed via the proxy.
+	client := sreq.New().
+		SetTimeout(10 * time.Second).
+		SetConnReadDeadline(100 * time.Millisecond).
+		SetProxyFromURL("socks5://user:pass@" + ln.Addr().String())
+	start := time.Now()
+	if err = client.Get("http://127.0.0.1:1").Error(); err == nil {
+		t.Error("Client_SetConnDeadlineWithSOCKS5Proxy test failed")
+	}
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Errorf("Client_SetConnDeadlineWithSOCKS5Proxy took: %s, want it aborted by the read deadline", elapsed)
+	}
+
+	// SetTransport discards the deadlines, they are set on the new transport again.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	var dials int32
+	transport := sreq.DefaultTransport()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	data, err := client.
+		SetTransport(transport).
+		SetConnWriteDeadline(time.Second).
+		Get(ts.URL).
+		Text()
+	if err != nil || data != "hello world" || atomic.LoadInt32(&dials) != 1 {
+		t.Errorf("Client_SetConnDeadlineWithSOCKS5Proxy got: %q, dials: %d", data, dials)
+	}
+}
+
+func TestClient_SetCircuitBreaker(t *testing.T) {
+	var (
+		hits    int32
+		healthy int32
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	client := sreq.New().SetCircuitBreaker(sreq.NewCircuitBreaker(2, time.Minute, 100*time.Millisecond))
+	for i := 0; i < 2; i++ {
+		if err := client.Get(ts.URL).EnsureStatus(http.StatusInternalServerError).Error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Get(ts.URL).Error(); err != sreq.ErrCircuitOpen {
+		t.Errorf("Client_SetCircuitBreaker got: %v, want: %v", err, sreq.ErrCircuitOpen)
+	}
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("Client_SetCircuitBreaker got %d hits, want: 2", n)
+	}
+	if err := client.Get(other.URL).EnsureStatusOk().Error(); err != nil {
+		t.Errorf("Client_SetCircuitBreaker got: %v for another host, want: nil", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	atomic.StoreInt32(&healthy, 1)
+	for i := 0; i < 2; i++ {
+		if err := client.Get(ts.URL).EnsureStatusOk().Error(); err != nil {
+			t.Errorf("Client_SetCircuitBreaker got: %v after cooldown, want: nil", err)
+		}
+	}
+}
+
+func TestClient_SetOverallTimeout(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	client := sreq.New().
+		SetOverallTimeout(300*time.Millisecond).
+		SetRetry(100, 100*time.Millisecond, func(resp *sreq.Response) bool {
+			return resp.Err == nil && resp.RawResponse.StatusCode == http.StatusInternalServerError
+		})
+	start := time.Now()
+	err := client.Get(ts.URL).Error()
+	if err != context.DeadlineExceeded {
+		t.Errorf("Client_SetOverallTimeout got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Client_SetOverallTimeout took: %s, want less than 1s", elapsed)
+	}
+	if n := atomic.LoadInt32(&attempts); n < 2 || n > 4 {
+		t.Errorf("Client_SetOverallTimeout got %d attempts, want 2 to 4", n)
+	}
+
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer ts2.Close()
+
+	data, err := client.Get(ts2.URL).EnsureStatusOk().Text()
+	if err != nil || data != "hello world" {
+		t.Errorf("Client_SetOverallTimeout got: %q, want: %q", data, "hello world")
+	}
+}
+
+func TestClient_Shutdown(t *testing.T) {
+	stall := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stall:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(stall)
+
+	const n = 3
+	client := sreq.New()
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			errs <- client.Get(ts.URL).Error()
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	client.Shutdown()
+	timer := time.NewTimer(2 * time.Second)
+	defer timer.Stop()
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-errs:
+			if err != context.Canceled {
+				t.Errorf("Client_Shutdown got: %v, want: %v", err, context.Canceled)
+			}
+		case <-timer.C:
+			t.Fatal("Client_Shutdown didn't abort the in-flight requests")
+		}
+	}
+
+	if err := client.Get(ts.URL).Error(); err != context.Canceled {
+		t.Errorf("Client_Shutdown got: %v, want: %v", err, context.Canceled)
+	}
+}
+
+func TestClient_ShutdownReleasesCompletedRequests(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/nocontent" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	client.Get(ts.URL).EnsureStatusOk()
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		client.Head(ts.URL).EnsureStatusOk()
+		client.Get(ts.URL + "/nocontent").EnsureStatus(http.StatusNoContent)
+		client.Get(ts.URL).Text()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := runtime.NumGoroutine() - before; n > 10 {
+		t.Errorf("Client_ShutdownReleasesCompletedRequests got %d goroutines left, want none", n)
+	}
+}
+
+func TestClient_EnableSingleflight(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Write([]byte("hello " + r.Header.Get("X-User")))
+	}))
+	defer ts.Close()
+
+	const n = 10
+	var modified int32
+	client := sreq.New().
+		EnableSingleflight().
+		UseResponseInterceptors(func(resp *sreq.Response) error {
+			if resp.RawResponse.Header.Get("X-Modified") != "" {
+				atomic.AddInt32(&modified, 1)
+			}
+			resp.RawResponse.Header.Set("X-Modified", "1")
+			return nil
+		})
+	results := make(chan string, 2*n)
+	var wg sync.WaitGroup
+	for i := 0; i < 2*n; i++ {
+		user := "alice"
+		if i%2 == 1 {
+			user = "bob"
+		}
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			data, err := client.
+				Get(ts.URL,
+					sreq.WithHeaders(sreq.Headers{"X-User": user}),
+				).
+				EnsureStatusOk().
+				Text()
+			if err != nil {
+				data = err.Error()
+			}
+			results <- data
+		}(user)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	counts := make(map[string]int)
+	for data := range results {
+		counts[data]++
+	}
+	if counts["hello alice"] != n || counts["hello bob"] != n {
+		t.Errorf("Client_EnableSingleflight got: %v, want %d of each user", counts, n)
+	}
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Errorf("Client_EnableSingleflight got %d hits, want: 2", got)
+	}
+	if got := atomic.LoadInt32(&modified); got != 0 {
+		t.Errorf("Client_EnableSingleflight got %d responses modified by others, want: 0", got)
+	}
+}
+
+func TestClient_SetCache(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		hits = make(map[string]int)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/static":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	client := sreq.New().SetCache(sreq.NewLRUCache(16))
+	for _, path := range []string{"/static", "/etag", "/no-store"} {
+		b, err := client.Get(ts.URL + path).EnsureStatusOk().Content()
+		if err != nil || string(b) != "hello world" {
+			t.Fatalf("Client_SetCache got: %q, want: %q", b, "hello world")
+		}
+		b[0] = 'H'
+
+		data, err := client.Get(ts.URL + path).EnsureStatusOk().Text()
+		if err != nil || data != "hello world" {
+			t.Errorf("Client_SetCache got: %q for %s, want: %q", data, path, "hello world")
+		}
+	}
+
+	want := map[string]int{"/static": 1, "/etag": 2, "/no-store": 2}
+	mu.Lock()
+	if !reflect.DeepEqual(hits, want) {
+		t.Errorf("Client_SetCache got hits: %v, want: %v", hits, want)
+	}
+	mu.Unlock()
+
+	req := sreq.NewRequest(sreq.MethodGet, ts.URL+"/etag")
+	for _, c := range []*sreq.Client{client, client, sreq.New().SetCache(sreq.NewLRUCache(16))} {
+		data, err := c.Do(req).EnsureStatusOk().Text()
+		if err != nil || data != "hello world" {
+			t.Errorf("Client_SetCache got: %q, error: %v, want: %q", data, err, "hello world")
+		}
+	}
+}
+
+func TestClient_SetCacheWithCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/public":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+			w.Write([]byte(r.Header.Get("Accept-Language")))
+			return
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	client := sreq.New().SetCache(sreq.NewLRUCache(16))
+	tests := []struct {
+		path string
+		opts []sreq.RequestOption
+		want string
+	}{
+		{path: "/", opts: []sreq.RequestOption{sreq.WithBearerToken("alice")}, want: "Bearer alice"},
+		{path: "/", opts: []sreq.RequestOption{sreq.WithBearerToken("bob")}, want: "Bearer bob"},
+		{path: "/private", want: ""},
+		{path: "/private", opts: []sreq.RequestOption{sreq.WithBearerToken("bob")}, want: "Bearer bob"},
+		{path: "/public", opts: []sreq.RequestOption{sreq.WithBearerToken("alice")}, want: "Bearer alice"},
+		{path: "/public", opts: []sreq.RequestOption{sreq.WithBearerToken("bob")}, want: "Bearer alice"},
+		{path: "/vary", opts: []sreq.RequestOption{sreq.WithAcceptLanguage("en")}, want: "en"},
+		{path: "/vary", opts: []sreq.RequestOption{sreq.WithAcceptLanguage("zh")}, want: "zh"},
+		{path: "/vary", opts: []sreq.RequestOption{sreq.WithAcceptLanguage("zh")}, want: "zh"},
+	}
+	for _, test := range tests {
+		data, err := client.Get(ts.URL+test.path, test.opts...).EnsureStatusOk().Text()
+		if err != nil || data != test.want {
+			t.Errorf("Client_SetCache got: %q for %s, want: %q", data, test.path, test.want)
+		}
+	}
+}
+
+func TestClient_SetRequestSigner(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Content-Sha256") + "\n" + r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	const want = "d8362df47e730a24d0fd5640b719e973cd2181f30b691c76b26a34c2c6e58d43\n" +
+		"HMAC-SHA256 KeyId=key1, SignedHeaders=date;x-api-version, " +
+		"Signature=6c0256cc1e59764deeee21b55eba720284b41049ca08f2fff66507034f6cd7f3"
+	client := sreq.New().SetRequestSigner(sreq.HMACSigner("key1", "secret", []string{"Date", "X-Api-Version"}))
+	data, err := client.
+		Post(ts.URL+"/v1/items?b=2&a=1",
+			sreq.WithHeaders(sreq.Headers{
+				"Date":          "Mon, 02 Jan 2006 15:04:05 GMT",
+				"X-Api-Version": 2,
+			}),
+			sreq.WithJSON(sreq.H{"name": "sreq"}, false),
+		).
+		EnsureStatusOk().
+		Text()
+	if err != nil || data != want {
+		t.Errorf("Client_SetRequestSigner got: %q, want: %q", data, want)
+	}
+
+	err = client.
+		Post(ts.URL,
+			sreq.WithStreamingUpload(strings.NewReader("hello world"), "text/plain"),
+		).
+		Error()
+	if cErr, ok := err.(*sreq.ClientError); !ok || cErr.Err != sreq.ErrStreamBody {
+		t.Errorf("Client_SetRequestSigner got: %v, want: %v", err, sreq.ErrStreamBody)
+	}
+
+	err = sreq.New().SetRequestSigner(nil).Err
+	if cErr, ok := err.(*sreq.ClientError); !ok || cErr.Err != sreq.ErrNilSigner {
+		t.Errorf("Client_SetRequestSigner got: %v, want: %v", err, sreq.ErrNilSigner)
+	}
+}
+
+func TestClient_SetHeaderPropagator(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Traceparent") + ";" + r.Header.Get("X-Seen")))
+	}))
+	defer ts.Close()
+
+	type traceKey struct{}
+	client := sreq.New().
+		SetHeaderPropagator(func(ctx context.Context, h http.Header) {
+			if traceID, ok := ctx.Value(traceKey{}).(string); ok {
+				h.Set("Traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+			}
+		}).
+		UseRequestInterceptors(func(req *sreq.Request) error {
+			req.SetHeader("X-Seen", req.RawRequest.Header.Get("Traceparent"))
+			return nil
+		})
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	data, err := client.
+		Get(ts.URL, sreq.WithContextValue(traceKey{}, "4bf92f3577b34da6a3ce929d0e0e4736")).
+		EnsureStatusOk().
+		Text()
+	if want := traceparent + ";" + traceparent; err != nil || data != want {
+		t.Errorf("Client_SetHeaderPropagator got: %q, want: %q", data, want)
+	}
+
+	data, err = client.SetHeaderPropagator(nil).Get(ts.URL).EnsureStatusOk().Text()
+	if err != nil || data != ";" {
+		t.Errorf("Client_SetHeaderPropagator got: %q, want: %q", data, ";")
+	}
+}
+
+func TestClient_SetTokenSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	calls := 0
+	client := sreq.New().SetTokenSourceWithExpiry(func() (string, time.Time, error) {
+		calls++
+		return "token-" + strconv.Itoa(calls), time.Now().Add(time.Minute), nil
+	})
+	for i := 0; i < 2; i++ {
+		data, err := client.Post(ts.URL, sreq.WithText("hello world")).EnsureStatusOk().Text()
+		if err != nil || data != "hello world" {
+			t.Errorf("Client_SetTokenSource got: %q, error: %v, want: %q", data, err, "hello world")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Client_SetTokenSource got %d calls, want: 2", calls)
+	}
+
+	calls = 0
+	client = sreq.New().SetTokenSource(func() (string, error) {
+		calls++
+		return "token-2", nil
+	})
+	for i := 0; i < 2; i++ {
+		if err := client.Get(ts.URL).EnsureStatusOk().Error(); err != nil {
+			t.Error(err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Client_SetTokenSource got %d calls, want: 2", calls)
+	}
+
+	err := sreq.New().
+		SetTokenSource(func() (string, error) {
+			return "", errors.New("token unavailable")
+		}).
+		Get(ts.URL).
+		Error()
+	if _, ok := err.(*sreq.ClientError); !ok {
+		t.Errorf("Client_SetTokenSource got: %v, want a *ClientError", err)
+	}
+
+	calls = 0
+	client = sreq.New().
+		SetTokenSource(nil).
+		SetTokenSource(func() (string, error) {
+			calls++
+			return "token-" + strconv.Itoa(calls), nil
+		}).
+		SetTokenRefreshOnUnauthorized(false)
+	resp := client.Get(ts.URL)
+	if err = resp.Error(); err != nil || resp.RawResponse.StatusCode != http.StatusUnauthorized || calls != 1 {
+		t.Errorf("Client_SetTokenSource got error: %v, %d calls, want a 401 response and 1 call", err, calls)
 	}
 }
 
-func TestClient_AppendClientCertificates(t *testing.T) {
-	cert := tls.Certificate{}
+func TestClient_SetBaseURL(t *testing.T) {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + " " + r.URL.RequestURI()))
+		})
+	}
+	api := httptest.NewServer(handler("api"))
+	defer api.Close()
+	other := httptest.NewServer(handler("other"))
+	defer other.Close()
+
+	client := sreq.New().SetBaseURL(api.URL + "/v1/")
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"/v2/users?page=1", "api /v2/users?page=1"},
+		{"users/1", "api /v1/users/1"},
+		{other.URL + "/v1/users", "other /v1/users"},
+	}
+	for _, test := range tests {
+		data, err := client.Get(test.url).EnsureStatusOk().Text()
+		if err != nil || data != test.want {
+			t.Errorf("Client_SetBaseURL got: %q, want: %q", data, test.want)
+		}
+	}
 
-	rawClient, err := sreq.New().AppendClientCertificates(cert).Raw()
-	if err != nil {
-		t.Fatal(err)
+	for _, base := range []string{"/v1", "http://[::1"} {
+		if _, err := sreq.New().SetBaseURL(base).Raw(); err == nil {
+			t.Errorf("Client_SetBaseURL accepted: %q", base)
+		}
 	}
+}
 
-	transport, ok := rawClient.Transport.(*http.Transport)
-	if !ok || transport == nil || transport.TLSClientConfig == nil ||
-		len(transport.TLSClientConfig.Certificates) != 1 {
-		t.Fatal("Client_AppendClientCertificates test failed")
+func TestClient_SetDefaultHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		w.Write([]byte(strings.Join([]string{
+			strings.Join(r.Header["Accept"], ","),
+			strings.Join(r.Header["X-Tag"], ","),
+			r.UserAgent(),
+			strings.Join(q["key"], ","),
+			strings.Join(q["page"], ","),
+		}, ";")))
+	}))
+	defer ts.Close()
+
+	client := sreq.New().
+		SetDefaultHeaders(sreq.Headers{
+			"Accept":     "application/json",
+			"X-Tag":      []string{"a", "b"},
+			"User-Agent": "sdk/1.0",
+		}).
+		SetDefaultQuery(sreq.Params{
+			"key": "secret",
+		})
+	tests := []struct {
+		opts []sreq.RequestOption
+		want string
+	}{
+		{
+			want: "application/json;a,b;sdk/1.0;secret;",
+		},
+		{
+			opts: []sreq.RequestOption{
+				sreq.WithHeaders(sreq.Headers{"Accept": "text/plain", "X-Tag": "c"}),
+				sreq.WithUserAgent("custom"),
+				sreq.WithQuery(sreq.Params{"key": []string{"k1", "k2"}, "page": 1}),
+			},
+			want: "text/plain;c;custom;k1,k2;1",
+		},
+	}
+	for _, test := range tests {
+		data, err := client.Get(ts.URL, test.opts...).EnsureStatusOk().Text()
+		if err != nil || data != test.want {
+			t.Errorf("Client_SetDefaultHeaders got: %q, want: %q", data, test.want)
+		}
 	}
 
-	rawClient, err = sreq.New().SetTransport(nil).AppendClientCertificates(cert).Raw()
+	_, err := sreq.New().SetDefaultHeaders(sreq.Headers{"X-Bad": "a\r\nb"}).Raw()
 	if err == nil {
-		t.Error("Client_AppendClientCertificates test failed")
+		t.Error("Client_SetDefaultHeaders test failed")
 	}
 }
 
-func TestClient_AppendRootCAs(t *testing.T) {
-	const (
-		pemFileExist    = "./testdata/root-ca.pem"
-		pemFileNotExist = "./testdata/root-ca-not-exist.pem"
-	)
+func TestNewAPIClient(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(strings.Join([]string{
+			r.URL.RequestURI(),
+			r.Header.Get("Accept"),
+			r.Header.Get("Authorization"),
+		}, ";")))
+	}))
+	defer ts.Close()
 
-	rawClient, err := sreq.New().AppendRootCAs(pemFileExist).Raw()
+	client := sreq.NewAPIClient(ts.URL+"/v1/",
+		sreq.WithClientHeaders(sreq.Headers{"Accept": "application/json"}),
+		sreq.WithClientQuery(sreq.Params{"key": "secret"}),
+		sreq.WithClientBearerToken("token"),
+		sreq.WithClientTimeout(5*time.Second),
+		sreq.WithClientRetry(2, 10*time.Millisecond, func(resp *sreq.Response) bool {
+			return resp.Err == nil && resp.RawResponse.StatusCode == http.StatusServiceUnavailable
+		}),
+	)
+	rawClient, err := client.Raw()
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	transport, ok := rawClient.Transport.(*http.Transport)
-	if !ok || transport == nil || transport.TLSClientConfig == nil ||
-		transport.TLSClientConfig.RootCAs == nil {
-		t.Error("Client_AppendRootCAs test failed")
+	if rawClient.Timeout != 5*time.Second {
+		t.Errorf("NewAPIClient got timeout: %s, want: %s", rawClient.Timeout, 5*time.Second)
 	}
 
-	rawClient, err = sreq.New().AppendRootCAs(pemFileNotExist).Raw()
-	if err == nil {
-		t.Error("Client_AppendRootCAs test failed")
+	data, err := client.Get("users").EnsureStatusOk().Text()
+	if want := "/v1/users?key=secret;application/json;Bearer token"; err != nil || data != want {
+		t.Errorf("NewAPIClient got: %q, want: %q", data, want)
 	}
-
-	rawClient, err = sreq.New().SetTransport(nil).AppendRootCAs(pemFileExist).Raw()
-	if err == nil {
-		t.Error("Client_AppendRootCAs test failed")
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("NewAPIClient got %d attempts, want: 2", n)
 	}
-}
 
-func TestClient_DisableVerify(t *testing.T) {
-	rawClient, err := sreq.New().SetTransport(nil).DisableVerify().Raw()
-	if err == nil {
-		t.Error("Client_DisableVerify test failed")
+	data, err = client.Get("users", sreq.WithBasicAuth("user", "pass")).EnsureStatusOk().Text()
+	if want := "/v1/users?key=secret;application/json;Basic dXNlcjpwYXNz"; err != nil || data != want {
+		t.Errorf("NewAPIClient got: %q, want: %q", data, want)
 	}
 
-	rawClient, err = sreq.New().DisableVerify().Raw()
-	if err != nil {
-		t.Fatal(err)
+	client = sreq.NewAPIClient(ts.URL, sreq.WithClientBasicAuth("user", "pass"))
+	data, err = client.Get("/").EnsureStatusOk().Text()
+	if want := "/;;Basic dXNlcjpwYXNz"; err != nil || data != want {
+		t.Errorf("NewAPIClient got: %q, want: %q", data, want)
 	}
 
-	transport, ok := rawClient.Transport.(*http.Transport)
-	if !ok || transport == nil || transport.TLSClientConfig == nil ||
-		!transport.TLSClientConfig.InsecureSkipVerify {
-		t.Error("Client_DisableVerify test failed")
+	if _, err = sreq.NewAPIClient("/v1").Raw(); err == nil {
+		t.Error("NewAPIClient test failed")
 	}
 }
 
@@ -250,6 +1260,106 @@ func TestClient_SetRetry(t *testing.T) {
 	}
 }
 
+func TestClient_SetRetryMaxDuration(t *testing.T) {
+	var attempts, conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		if r.URL.Query().Get("slow") != "" {
+			time.Sleep(500 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("unavailable"))
+	}))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	client := sreq.New().
+		SetRetryOnStatus(10, 50*time.Millisecond, http.StatusServiceUnavailable).
+		SetRetryMaxDuration(180 * time.Millisecond)
+	_, err := client.
+		Get(ts.URL).
+		Raw()
+	if err != sreq.ErrRetryMaxDurationExceeded {
+		t.Fatal("Client_SetRetryMaxDuration test failed")
+	}
+	if attempts < 2 || attempts >= 10 {
+		t.Errorf("Client_SetRetryMaxDuration got attempts: %d", attempts)
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("Client_SetRetryMaxDuration got %d connections, want: 1", n)
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+	start := time.Now()
+	_, err = client.
+		Get(ts.URL,
+			sreq.WithQuery(sreq.Params{
+				"slow": 1,
+			}),
+			sreq.WithRetryMaxDuration(100*time.Millisecond),
+		).
+		Raw()
+	if n := atomic.LoadInt32(&attempts); err != sreq.ErrRetryMaxDurationExceeded || n != 1 {
+		t.Errorf("Client_SetRetryMaxDuration got attempts: %d, want: %d", n, 1)
+	}
+	// The budget caps the slow attempt as well.
+	if elapsed := time.Since(start); elapsed >= 400*time.Millisecond {
+		t.Errorf("Client_SetRetryMaxDuration took: %s, want less than: %s", elapsed, 400*time.Millisecond)
+	}
+}
+
+func TestClient_SetRetryOnStatus(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	client := sreq.New().SetRetryOnStatus(3, 10*time.Millisecond,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout)
+	_, err := client.
+		Get(ts.URL).
+		EnsureStatusOk().
+		Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Errorf("Client_SetRetryOnStatus got attempts: %d, want: %d", attempts, 3)
+	}
+
+	if sreq.RetryOnStatus(http.StatusServiceUnavailable)(new(sreq.Response)) {
+		t.Error("Client_SetRetryOnStatus test failed")
+	}
+}
+
+func TestClient_Put(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != sreq.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer ts.Close()
+
+	var intercepted bool
+	client := sreq.New().UseRequestInterceptors(func(req *sreq.Request) error {
+		intercepted = req.RawRequest.Method == sreq.MethodPut
+		return nil
+	})
+	err := client.Put(ts.URL).EnsureStatusOk().Error()
+	if err != nil || !intercepted {
+		t.Errorf("Client_Put got error: %v, intercepted: %t, want the client's interceptor fired", err, intercepted)
+	}
+}
+
 func TestClient_UseRequestInterceptors(t *testing.T) {
 	logInterceptor := func(req *sreq.Request) error {
 		rawRequest := req.RawRequest
@@ -348,6 +1458,252 @@ func TestClient_UseResponseInterceptors(t *testing.T) {
 	}
 }
 
+func TestClient_UseResponseInterceptorsCtx(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	var (
+		calls   []string
+		gotReq  *sreq.Request
+		attempt = -1
+	)
+	client := sreq.New().
+		UseResponseInterceptors(func(resp *sreq.Response) error {
+			calls = append(calls, "plain")
+			return nil
+		}).
+		UseResponseInterceptorsCtx(func(req *sreq.Request, resp *sreq.Response, n int) error {
+			calls = append(calls, "ctx")
+			gotReq, attempt = req, n
+			return nil
+		})
+
+	req := sreq.NewRequest(sreq.MethodGet, ts.URL).
+		SetRetry(3, 10*time.Millisecond, sreq.RetryOnStatus(http.StatusServiceUnavailable))
+	if err := client.Do(req).EnsureStatusOk().Error(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"plain", "ctx"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("Client_UseResponseInterceptorsCtx got calls: %v, want: %v", calls, want)
+	}
+	if gotReq != req || attempt != 2 {
+		t.Errorf("Client_UseResponseInterceptorsCtx got attempt: %d, want: %d", attempt, 2)
+	}
+
+	errAborted := errors.New("aborted")
+	err := client.
+		UseResponseInterceptorsCtx(func(req *sreq.Request, resp *sreq.Response, n int) error {
+			return errAborted
+		}).
+		Get(ts.URL).
+		Error()
+	if err != errAborted || attempt != 0 {
+		t.Errorf("Client_UseResponseInterceptorsCtx got: %v, attempt: %d, want: %v, attempt: %d", err, attempt, errAborted, 0)
+	}
+}
+
+func TestClient_UseAttemptInterceptors(t *testing.T) {
+	var requests, conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("hello world"))
+	}))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	var (
+		attempts  []int
+		statuses  []int
+		responses int
+	)
+	client := sreq.New().
+		SetRetry(3, 10*time.Millisecond, sreq.RetryOnStatus(http.StatusServiceUnavailable)).
+		UseAttemptInterceptors(func(req *sreq.Request, resp *sreq.Response, attempt int) error {
+			attempts = append(attempts, attempt)
+			statuses = append(statuses, resp.RawResponse.StatusCode)
+			return nil
+		}).
+		UseResponseInterceptors(func(resp *sreq.Response) error {
+			responses++
+			return nil
+		})
+	if _, err := client.Get(ts.URL).EnsureStatusOk().Text(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1, 2}; !reflect.DeepEqual(attempts, want) {
+		t.Errorf("Client_UseAttemptInterceptors got attempts: %v, want: %v", attempts, want)
+	}
+	if want := []int{503, 503, 200}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Client_UseAttemptInterceptors got statuses: %v, want: %v", statuses, want)
+	}
+	if responses != 1 {
+		t.Errorf("Client_UseAttemptInterceptors got %d response interceptor calls, want: 1", responses)
+	}
+
+	errAborted := errors.New("aborted")
+	atomic.StoreInt32(&requests, 2)
+	err := client.
+		UseAttemptInterceptors(func(req *sreq.Request, resp *sreq.Response, attempt int) error {
+			return errAborted
+		}).
+		Get(ts.URL).
+		Error()
+	if err != errAborted || atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("Client_UseAttemptInterceptors got: %v, requests: %d, want: %v, requests: 3",
+			err, atomic.LoadInt32(&requests), errAborted)
+	}
+
+	// The body of the aborted response should be closed so that its connection is reused.
+	client.Get(ts.URL).Error()
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("Client_UseAttemptInterceptors got %d connections, want: 1", n)
+	}
+}
+
+func TestClient_ClearInterceptors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Trace") + ";" + r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	var responses int
+	client := sreq.New().
+		SetTokenSource(func() (string, error) {
+			return "token", nil
+		}).
+		UseRequestInterceptors(func(req *sreq.Request) error {
+			req.SetHeader("X-Trace", "1")
+			return nil
+		}).
+		UseResponseInterceptors(func(resp *sreq.Response) error {
+			responses++
+			return nil
+		})
+	data, err := client.Get(ts.URL).EnsureStatusOk().Text()
+	if want := "1;Bearer token"; err != nil || data != want || responses != 1 {
+		t.Errorf("Client_ClearInterceptors got: %q, responses: %d, want: %q, responses: 1", data, responses, want)
+	}
+
+	client.ClearRequestInterceptors().ClearResponseInterceptors()
+	data, err = client.Get(ts.URL).EnsureStatusOk().Text()
+	if want := ";"; err != nil || data != want || responses != 1 {
+		t.Errorf("Client_ClearInterceptors got: %q, responses: %d, want: %q, responses: 1", data, responses, want)
+	}
+
+	client.
+		SetTokenSource(func() (string, error) {
+			return "token", nil
+		}).
+		SetRequestInterceptors(func(req *sreq.Request) error {
+			req.SetHeader("X-Trace", "2")
+			return nil
+		}).
+		SetResponseInterceptors(func(resp *sreq.Response) error {
+			responses += 10
+			return nil
+		})
+	data, err = client.Get(ts.URL).EnsureStatusOk().Text()
+	if want := "2;"; err != nil || data != want || responses != 11 {
+		t.Errorf("Client_ClearInterceptors got: %q, responses: %d, want: %q, responses: 11", data, responses, want)
+	}
+}
+
+func TestClient_GetFollowing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		if n < 5 {
+			http.Redirect(w, r, "/?n="+strconv.Itoa(n+1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	var hops []int
+	resp, err := client.GetFollowing(ts.URL, func(hop int, resp *sreq.Response) (bool, error) {
+		hops = append(hops, hop)
+		return hop < 2, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.RawResponse.StatusCode != http.StatusFound ||
+		resp.RawResponse.Header.Get("Location") != "/?n=2" || !reflect.DeepEqual(hops, []int{1, 2}) {
+		t.Error("Client_GetFollowing test failed")
+	}
+
+	data, err := client.GetFollowing(ts.URL, func(hop int, resp *sreq.Response) (bool, error) {
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := data.Text(); text != "done" {
+		t.Error("Client_GetFollowing test failed")
+	}
+
+	wantErr := errors.New("untrusted")
+	_, err = client.GetFollowing(ts.URL, func(hop int, resp *sreq.Response) (bool, error) {
+		return false, wantErr
+	})
+	if err != wantErr {
+		t.Error("Client_GetFollowing test failed")
+	}
+}
+
+func TestClient_GetFollowingCrossHost(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization") + ";" + r.Header.Get("Cookie")))
+	}))
+	defer other.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/same" {
+			http.Redirect(w, r, "/final", http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/final" {
+			w.Write([]byte(r.Header.Get("Authorization") + ";" + r.Header.Get("Cookie")))
+			return
+		}
+		// Redirect to another host, i.e. "localhost" rather than "127.0.0.1".
+		http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer ts.Close()
+
+	follow := func(hop int, resp *sreq.Response) (bool, error) {
+		return true, nil
+	}
+	opts := []sreq.RequestOption{
+		sreq.WithBearerToken("secret"),
+		sreq.WithCookies(&http.Cookie{Name: "uid", Value: "10086"}),
+	}
+	client := sreq.New()
+	resp, err := client.GetFollowing(ts.URL+"/same", follow, opts...)
+	if data, _ := resp.Text(); err != nil || data != "Bearer secret;uid=10086" {
+		t.Errorf("Client_GetFollowing got: %q, want: %q", data, "Bearer secret;uid=10086")
+	}
+
+	resp, err = client.GetFollowing(ts.URL, follow, opts...)
+	if data, _ := resp.Text(); err != nil || data != ";" {
+		t.Errorf("Client_GetFollowing got: %q, want: %q", data, ";")
+	}
+}
+
 func TestClient_FilterCookie(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.SetCookie(w, &http.Cookie{
@@ -409,6 +1765,61 @@ func TestClient_Do(t *testing.T) {
 	}
 }
 
+func TestClient_DoBatch(t *testing.T) {
+	var inFlight, maxInFlight int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		if r.URL.Query().Get("i") == "3" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		w.Write([]byte(r.URL.Query().Get("i")))
+	}))
+	defer ts.Close()
+
+	reqs := make([]*sreq.Request, 10)
+	for i := range reqs {
+		reqs[i] = sreq.NewRequest(sreq.MethodGet, ts.URL).SetQuery(sreq.Params{"i": i})
+	}
+
+	client := sreq.New()
+	resps := client.DoBatch(context.Background(), reqs, 3)
+	for i, resp := range resps {
+		data, err := resp.EnsureStatusOk().Text()
+		if i == 3 {
+			if err == nil {
+				t.Error("Client_DoBatch test failed")
+			}
+			continue
+		}
+		if err != nil || data != strconv.Itoa(i) {
+			t.Errorf("Client_DoBatch got: %q, want: %q", data, strconv.Itoa(i))
+		}
+	}
+	if maxInFlight > 3 {
+		t.Errorf("Client_DoBatch got max in flight: %d, want: <= %d", maxInFlight, 3)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := range reqs {
+		reqs[i] = sreq.NewRequest(sreq.MethodGet, ts.URL)
+	}
+	for _, resp := range client.DoBatch(ctx, reqs, 3) {
+		if resp.Err != context.Canceled {
+			t.Error("Client_DoBatch test failed")
+		}
+	}
+}
+
 func TestAutoGzip(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -494,6 +1905,78 @@ func TestAutoGzip(t *testing.T) {
 	}
 }
 
+func TestAutoZstd(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Encoding", "zstd")
+
+		zw, _ := zstd.NewWriter(w)
+		_, _ = zw.Write([]byte(r.URL.Query().Get("q")))
+		zw.Close()
+	}))
+	defer ts.Close()
+
+	resp := sreq.
+		Get(ts.URL,
+			sreq.WithQuery(sreq.Params{
+				"q": "hello",
+			}),
+			sreq.WithHeaders(sreq.Headers{
+				"Accept-Encoding": "zstd",
+			}),
+		)
+	data, err := resp.Text()
+	if err != nil || data != "hello" {
+		t.Errorf("AutoZstd got: %q, error: %v, want: %q", data, err, "hello")
+	}
+	if resp.OriginalEncoding != "zstd" {
+		t.Errorf("AutoZstd got original encoding: %q, want: %q", resp.OriginalEncoding, "zstd")
+	}
+}
+
+func TestClient_DoStreaming(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("hello world"))
+	zw.Close()
+	compressed := buf.Bytes()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "identity" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// Misbehave by compressing anyway, so the body can be checked untouched.
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed)
+	}))
+	defer ts.Close()
+
+	var intercepted int
+	client := sreq.New().
+		UseRequestInterceptors(func(req *sreq.Request) error {
+			intercepted++
+			return nil
+		}).
+		UseResponseInterceptors(func(resp *sreq.Response) error {
+			intercepted++
+			return nil
+		})
+	rawResponse, err := client.DoStreaming(sreq.NewRequest(sreq.MethodGet, ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rawResponse.Body.Close()
+
+	body, err := ioutil.ReadAll(rawResponse.Body)
+	if err != nil || !bytes.Equal(body, compressed) {
+		t.Errorf("Client_DoStreaming got: %q, want: %q", body, compressed)
+	}
+	if intercepted != 2 {
+		t.Errorf("Client_DoStreaming got %d interceptor calls, want: 2", intercepted)
+	}
+}
+
 func TestDefaultClient(t *testing.T) {
 	rawClient, err := sreq.DefaultClient.Raw()
 	if err != nil {
@@ -632,6 +2115,34 @@ func testDefaultClientSend(t *testing.T) {
 	}
 }
 
+func TestClient_Options(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		method string
+		send   func(url string, opts ...sreq.RequestOption) *sreq.Response
+	}{
+		{sreq.MethodConnect, sreq.Connect},
+		{sreq.MethodOptions, sreq.Options},
+		{sreq.MethodTrace, sreq.Trace},
+		{sreq.MethodConnect, sreq.New().Connect},
+		{sreq.MethodOptions, sreq.New().Options},
+		{sreq.MethodTrace, sreq.New().Trace},
+	}
+	for _, test := range tests {
+		resp, err := test.send(ts.URL).EnsureStatusOk().Raw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get("X-Method"); got != test.method {
+			t.Errorf("Client_%s got method: %q, want: %q", test.method, got, test.method)
+		}
+	}
+}
+
 func testDefaultClientDo(t *testing.T, req *sreq.Request) {
 	err := sreq.
 		Do(req).
@@ -795,3 +2306,489 @@ func testDefaultClientSetTransport(t *testing.T, rawClient *http.Client) {
 		t.Error("DefaultClient_SetTransport test failed")
 	}
 }
+
+func TestClient_SetLogger(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	var sb strings.Builder
+	client := sreq.New().SetLogger(log.New(&sb, "", 0))
+	data, err := client.Post(ts.URL).Text()
+	if err != nil || data != "hello world" {
+		t.Errorf("Client_SetLogger got: %q, want: %q", data, "hello world")
+	}
+
+	line := sb.String()
+	for _, want := range []string{"POST " + ts.URL, "status=201", "bytes=11", "duration="} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Client_SetLogger got: %q, want it contains: %q", line, want)
+		}
+	}
+
+	sb.Reset()
+	client.SetLogger(nil).Get(ts.URL).Text()
+	if sb.Len() != 0 {
+		t.Error("Client_SetLogger test failed")
+	}
+}
+
+func TestClient_SetStrictAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	var sb strings.Builder
+	client := sreq.New().SetLogger(log.New(&sb, "", 0))
+	data, err := client.
+		Get(ts.URL,
+			sreq.WithBasicAuth("user", "pass"),
+			sreq.WithBearerToken("token"),
+		).
+		Text()
+	if err != nil || data != "Bearer token" {
+		t.Errorf("Client_SetStrictAuth got: %q, want: %q", data, "Bearer token")
+	}
+	if !strings.Contains(sb.String(), sreq.ErrMultipleAuthSchemes.Error()) {
+		t.Errorf("Client_SetStrictAuth got log: %q, want a warning", sb.String())
+	}
+
+	client.SetStrictAuth(true)
+	err = client.
+		Get(ts.URL,
+			sreq.WithBasicAuth("user", "pass"),
+			sreq.WithBearerToken("token"),
+		).
+		Error()
+	if reqErr, ok := err.(*sreq.RequestError); !ok || reqErr.Err != sreq.ErrMultipleAuthSchemes {
+		t.Errorf("Client_SetStrictAuth got: %v, want: %v", err, sreq.ErrMultipleAuthSchemes)
+	}
+
+	data, err = client.
+		Get(ts.URL,
+			sreq.WithBearerToken("token-1"),
+			sreq.WithBearerToken("token-2"),
+		).
+		Text()
+	if err != nil || data != "Bearer token-2" {
+		t.Errorf("Client_SetStrictAuth got: %q, want: %q", data, "Bearer token-2")
+	}
+
+	err = client.
+		SetRequestSigner(sreq.HMACSigner("key1", "secret", nil)).
+		Get(ts.URL,
+			sreq.WithBearerToken("token"),
+		).
+		Error()
+	if reqErr, ok := err.(*sreq.RequestError); !ok || reqErr.Err != sreq.ErrMultipleAuthSchemes {
+		t.Errorf("Client_SetStrictAuth got: %v, want: %v", err, sreq.ErrMultipleAuthSchemes)
+	}
+}
+
+func TestClient_Build(t *testing.T) {
+	client := sreq.New().
+		SetBaseURL("http://127.0.0.1/v1/").
+		SetDefaultHeaders(sreq.Headers{"Accept": "application/json"}).
+		UseRequestInterceptors(func(req *sreq.Request) error {
+			req.SetHeader("X-Request-Id", "10086")
+			return nil
+		})
+	rawRequest, err := client.Build(sreq.MethodPost, "users",
+		sreq.WithQuery(sreq.Params{"page": 1}),
+		sreq.WithJSON(sreq.H{"name": "sreq"}, false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "http://127.0.0.1/v1/users?page=1"; rawRequest.URL.String() != want {
+		t.Errorf("Client_Build got URL: %q, want: %q", rawRequest.URL, want)
+	}
+	for k, want := range map[string]string{
+		"Accept":       "application/json",
+		"Content-Type": "application/json",
+		"X-Request-Id": "10086",
+	} {
+		if got := rawRequest.Header.Get(k); got != want {
+			t.Errorf("Client_Build got header %s: %q, want: %q", k, got, want)
+		}
+	}
+	body, err := ioutil.ReadAll(rawRequest.Body)
+	if want := `{"name":"sreq"}`; err != nil || strings.TrimSpace(string(body)) != want {
+		t.Errorf("Client_Build got body: %q, want: %q", body, want)
+	}
+
+	errForbidden := errors.New("forbidden")
+	_, err = client.
+		UseRequestInterceptors(func(req *sreq.Request) error {
+			return errForbidden
+		}).
+		Build(sreq.MethodGet, "users")
+	if err != errForbidden {
+		t.Errorf("Client_Build got: %v, want: %v", err, errForbidden)
+	}
+}
+
+func TestClient_Exchange(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	payload := []byte{0x00, 0x01, 0xfe, 0xff}
+	client := sreq.New()
+	data, rawResponse, err := client.Exchange(sreq.MethodPost, ts.URL, payload, "application/octet-stream")
+	if err != nil || !bytes.Equal(data, payload) {
+		t.Errorf("Client_Exchange got: %v, want: %v", data, payload)
+	}
+	if rawResponse == nil || rawResponse.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Error("Client_Exchange test failed")
+	}
+
+	_, rawResponse, err = client.Exchange(sreq.MethodPost, "http://127.0.0.1:1081^", payload, "")
+	if err == nil || rawResponse != nil {
+		t.Error("Client_Exchange test failed")
+	}
+}
+
+func TestClient_SubmitForm(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != sreq.MethodPost || r.PostFormValue("username") != "admin" ||
+			r.PostFormValue("password") != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:  "session",
+			Value: "s1",
+			Path:  "/",
+		})
+		http.Redirect(w, r, "/home", http.StatusFound)
+	})
+	mux.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("session")
+		if err != nil || cookie.Value != "s1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("welcome"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := sreq.New()
+	data, err := client.
+		SubmitForm(ts.URL+"/login", sreq.Form{
+			"username": "admin",
+			"password": "pass",
+		}).
+		EnsureStatusOk().
+		Text()
+	if err != nil || data != "welcome" {
+		t.Errorf("Client_SubmitForm got: %q, want: %q", data, "welcome")
+	}
+
+	cookie, err := client.FilterCookie(ts.URL, "session")
+	if err != nil || cookie.Value != "s1" {
+		t.Error("Client_SubmitForm test failed")
+	}
+}
+
+func TestClient_SetMinTLSVersion(t *testing.T) {
+	rawClient, err := sreq.New().
+		SetMinTLSVersion(tls.VersionTLS12).
+		SetMaxTLSVersion(tls.VersionTLS13).
+		Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := rawClient.Transport.(*http.Transport).TLSClientConfig
+	if config.MinVersion != tls.VersionTLS12 || config.MaxVersion != tls.VersionTLS13 {
+		t.Error("Client_SetMinTLSVersion test failed")
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{
+		MinVersion: tls.VersionTLS10,
+		MaxVersion: tls.VersionTLS10,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	_, err = sreq.New().
+		DisableVerify().
+		SetMinTLSVersion(tls.VersionTLS12).
+		Get(ts.URL).
+		Raw()
+	if err == nil {
+		t.Error("Client_SetMinTLSVersion test failed")
+	}
+
+	ts2 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts2.Close()
+
+	rawResponse, err := sreq.New().
+		DisableVerify().
+		SetMaxTLSVersion(tls.VersionTLS12).
+		Get(ts2.URL).
+		Raw()
+	if err != nil || rawResponse.TLS.Version != tls.VersionTLS12 {
+		t.Error("Client_SetMaxTLSVersion test failed")
+	}
+
+	for _, client := range []*sreq.Client{
+		sreq.New().SetTransport(nil).SetMinTLSVersion(tls.VersionTLS12),
+		sreq.New().SetTransport(nil).SetMaxTLSVersion(tls.VersionTLS12),
+	} {
+		if _, err = client.Raw(); err == nil {
+			t.Error("Client_SetMinTLSVersion test failed")
+		}
+	}
+}
+
+func TestClient_ForceHTTP1(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	if err := http2.ConfigureServer(ts.Config, nil); err != nil {
+		t.Fatal(err)
+	}
+	ts.TLS = &tls.Config{
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tests := []struct {
+		client *sreq.Client
+		want   string
+	}{
+		{sreq.New().DisableVerify().ForceHTTP2(), "HTTP/2.0"},
+		{sreq.New().DisableVerify().ForceHTTP2().ForceHTTP1(), "HTTP/1.1"},
+		{sreq.New().ForceHTTP1().DisableVerify().ForceHTTP2(), "HTTP/2.0"},
+	}
+	for _, test := range tests {
+		data, err := test.client.Get(ts.URL).Text()
+		if err != nil || data != test.want {
+			t.Errorf("Client_ForceHTTP1 got: %q, want: %q, error: %v", data, test.want, err)
+		}
+	}
+
+	for _, client := range []*sreq.Client{
+		sreq.New().SetTransport(nil).ForceHTTP1(),
+		sreq.New().SetTransport(nil).ForceHTTP2(),
+	} {
+		if _, err := client.Raw(); err == nil {
+			t.Error("Client_ForceHTTP1 test failed")
+		}
+	}
+}
+
+type closeTracker struct {
+	io.ReadCloser
+	closed bool
+}
+
+func (ct *closeTracker) Close() error {
+	ct.closed = true
+	return ct.ReadCloser.Close()
+}
+
+type trackingTransport struct {
+	body *closeTracker
+}
+
+func (tt *trackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := sreq.DefaultTransport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	tt.body = &closeTracker{ReadCloser: resp.Body}
+	resp.Body = tt.body
+	return resp, nil
+}
+
+func TestClient_SetAutoCloseBodyOnError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("internal server error"))
+	}))
+	defer ts.Close()
+
+	for _, enabled := range []bool{true, false} {
+		transport := &trackingTransport{}
+		client := sreq.New().
+			SetTransport(transport).
+			SetAutoCloseBodyOnError(enabled)
+		_, err := client.
+			Get(ts.URL).
+			EnsureStatusOk().
+			Text()
+		if err == nil {
+			t.Error("Client_SetAutoCloseBodyOnError test failed")
+		}
+		if transport.body.closed != enabled {
+			t.Errorf("Client_SetAutoCloseBodyOnError(%t) got closed: %t", enabled, transport.body.closed)
+		}
+		transport.body.Close()
+	}
+}
+
+func TestClient_SetBearerTokenFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "sreq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "token")
+	if err = ioutil.WriteFile(path, []byte("token1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client := sreq.New().SetBearerTokenFile(path)
+	data, err := client.Get(ts.URL).Text()
+	if err != nil || data != "Bearer token1" {
+		t.Errorf("Client_SetBearerTokenFile got: %q, want: %q", data, "Bearer token1")
+	}
+
+	if err = ioutil.WriteFile(path, []byte("token2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(time.Minute)
+	if err = os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = client.Get(ts.URL).Text()
+	if err != nil || data != "Bearer token2" {
+		t.Errorf("Client_SetBearerTokenFile got: %q, want: %q", data, "Bearer token2")
+	}
+
+	os.Remove(path)
+	_, err = client.Get(ts.URL).Raw()
+	if err == nil {
+		t.Error("Client_SetBearerTokenFile test failed")
+	}
+}
+
+func TestClient_SetMaxResponseBodySize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"msg":"hello world"}`))
+	}))
+	defer ts.Close()
+
+	client := sreq.New().SetMaxResponseBodySize(8)
+	resp := client.Get(ts.URL)
+	if _, err := resp.Content(); err != sreq.ErrResponseBodyTooLarge {
+		t.Errorf("Client_SetMaxResponseBodySize got error: %v, want: %v", err, sreq.ErrResponseBodyTooLarge)
+	}
+	if _, err := resp.Text(); err != sreq.ErrResponseBodyTooLarge {
+		t.Errorf("Client_SetMaxResponseBodySize got error: %v, want: %v", err, sreq.ErrResponseBodyTooLarge)
+	}
+	if err := client.Get(ts.URL).JSON(new(sreq.H)); err != sreq.ErrResponseBodyTooLarge {
+		t.Errorf("Client_SetMaxResponseBodySize got error: %v, want: %v", err, sreq.ErrResponseBodyTooLarge)
+	}
+	if err := client.Get(ts.URL).XML(new(struct{})); err != sreq.ErrResponseBodyTooLarge {
+		t.Errorf("Client_SetMaxResponseBodySize got error: %v, want: %v", err, sreq.ErrResponseBodyTooLarge)
+	}
+
+	data, err := client.SetMaxResponseBodySize(21).Get(ts.URL).Text()
+	if err != nil || data != `{"msg":"hello world"}` {
+		t.Errorf("Client_SetMaxResponseBodySize got: %q, want: %q", data, `{"msg":"hello world"}`)
+	}
+}
+
+func TestClient_UploadArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sreq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("world"), 0644)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil || len(r.TransferEncoding) == 0 || r.TransferEncoding[0] != "chunked" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var entries []string
+		switch r.Header.Get("Content-Type") {
+		case "application/gzip":
+			gr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			tr := tar.NewReader(gr)
+			for {
+				h, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				b, _ := ioutil.ReadAll(tr)
+				entries = append(entries, h.Name+"="+string(b))
+			}
+		case "application/zip":
+			zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for _, f := range zr.File {
+				rc, _ := f.Open()
+				b, _ := ioutil.ReadAll(rc)
+				rc.Close()
+				entries = append(entries, f.Name+"="+string(b))
+			}
+		default:
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		sort.Strings(entries)
+		w.Write([]byte(strings.Join(entries, ",")))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	const want = "a.txt=hello,sub/=,sub/b.txt=world"
+	for _, format := range []string{"tar.gz", "zip"} {
+		data, err := client.
+			UploadArchive(ts.URL, dir, format).
+			EnsureStatusOk().
+			Text()
+		if err != nil || data != want {
+			t.Errorf("Client_UploadArchive(%s) got: %q, want: %q, error: %v", format, data, want, err)
+		}
+	}
+
+	if err = client.UploadArchive(ts.URL, dir, "rar").Error(); err == nil {
+		t.Error("Client_UploadArchive test failed")
+	}
+	if err = client.UploadArchive(ts.URL, filepath.Join(dir, "a.txt"), "zip").Error(); err == nil {
+		t.Error("Client_UploadArchive test failed")
+	}
+}
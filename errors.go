@@ -9,9 +9,33 @@ var (
 	// ErrUnexpectedTransport can be used if assert a RoundTripper as a non-nil *http.Transport instance failed.
 	ErrUnexpectedTransport = errors.New("current transport isn't a non-nil *http.Transport instance")
 
+	// ErrUnsupportedTransportField can be used when a transport field isn't supported by the current Go version.
+	ErrUnsupportedTransportField = errors.New("current transport field isn't supported by this Go version")
+
+	// ErrUnexpectedDialer can be used if assert a proxy dialer as a proxy.ContextDialer failed.
+	ErrUnexpectedDialer = errors.New("current proxy dialer doesn't support dialing with context")
+
 	// ErrNilContext can be used when the context is nil.
 	ErrNilContext = errors.New("nil Context")
 
+	// ErrInvalidHeader can be used when a header field name or value contains illegal characters, such as CR or LF.
+	ErrInvalidHeader = errors.New("sreq: invalid header field name or value")
+
+	// ErrRetryMaxDurationExceeded can be used when the retry policy exceeds its max duration.
+	ErrRetryMaxDurationExceeded = errors.New("sreq: retry max duration exceeded")
+
+	// ErrNilBody can be used when the HTTP request body is required but not set.
+	ErrNilBody = errors.New("sreq: nil body")
+
+	// ErrStreamBody can be used when the HTTP request body is a stream that cannot be read twice.
+	ErrStreamBody = errors.New("sreq: request body is a stream and cannot be read twice")
+
+	// ErrTooManyRedirects can be used when following redirects manually exceeds the limit.
+	ErrTooManyRedirects = errors.New("sreq: stopped after 10 redirects")
+
+	// ErrWriteTimeout can be used when the HTTP request body makes no progress within the write timeout.
+	ErrWriteTimeout = errors.New("sreq: write timeout exceeded while uploading request body")
+
 	// ErrNilCookieJar can be used when the cookie jar is nil.
 	ErrNilCookieJar = errors.New("sreq: nil cookie jar")
 
@@ -26,6 +50,36 @@ var (
 
 	// ErrResponseNamedCookieNotPresent can be used when named cookie of the HTTP response not present.
 	ErrResponseNamedCookieNotPresent = errors.New("sreq: named cookie not present")
+
+	// ErrChecksumMismatch can be used when the HTTP response body doesn't match the expected checksum.
+	ErrChecksumMismatch = errors.New("sreq: checksum mismatch")
+
+	// ErrResponseBodyStreamed can be used when the HTTP response body has been taken over by Stream.
+	ErrResponseBodyStreamed = errors.New("sreq: response body has been streamed")
+
+	// ErrResponseBodyTooLarge can be used when the HTTP response body exceeds the max size.
+	ErrResponseBodyTooLarge = errors.New("sreq: response body too large")
+
+	// ErrMissingPathParam can be used when a placeholder of the URL path is left unfilled.
+	ErrMissingPathParam = errors.New("sreq: missing path param")
+
+	// ErrUnusedPathParam can be used when a path param has no placeholder in the URL path.
+	ErrUnusedPathParam = errors.New("sreq: unused path param")
+
+	// ErrInvalidBaseURL can be used when the base URL of the client isn't an absolute URL.
+	ErrInvalidBaseURL = errors.New("sreq: base URL must be absolute")
+
+	// ErrNoRateLimit can be used when the HTTP response has no rate limit headers.
+	ErrNoRateLimit = errors.New("sreq: rate limit headers not found")
+
+	// ErrMultipleAuthSchemes can be used when more than one authorization scheme is applied to a request.
+	ErrMultipleAuthSchemes = errors.New("sreq: multiple authorization schemes applied to one request")
+
+	// ErrCircuitOpen can be used when a request is rejected by the circuit breaker of the client.
+	ErrCircuitOpen = errors.New("sreq: circuit breaker is open")
+
+	// ErrNilSigner can be used when a nil request signer is given to the client.
+	ErrNilSigner = errors.New("sreq: nil request signer")
 )
 
 type (
@@ -40,6 +94,15 @@ type (
 		Cause string
 		Err   error
 	}
+
+	// StatusError records a non-2xx HTTP response, can be used when DecodeByStatus decodes a failure.
+	// Failure is the value which the HTTP response body is decoded into, or nil if it can't be decoded,
+	// in that case Err records the decode error.
+	StatusError struct {
+		StatusCode int
+		Failure    interface{}
+		Err        error
+	}
 )
 
 // Error implements error interface.
@@ -61,3 +124,16 @@ func (req *RequestError) Error() string {
 func (req *RequestError) Unwrap() error {
 	return req.Err
 }
+
+// Error implements error interface.
+func (e *StatusError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("sreq: bad status: %d, decode failure: %s", e.StatusCode, e.Err.Error())
+	}
+	return fmt.Sprintf("sreq: bad status: %d", e.StatusCode)
+}
+
+// Unwrap unpacks and returns the decode error of e, if any.
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
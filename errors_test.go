@@ -1,6 +1,7 @@
 package sreq_test
 
 import (
+	"io"
 	"strings"
 	"testing"
 
@@ -45,3 +46,17 @@ func TestRequestError(t *testing.T) {
 		t.Error("RequestError test failed")
 	}
 }
+
+func TestStatusError(t *testing.T) {
+	err := &sreq.StatusError{
+		StatusCode: 400,
+	}
+	if err.Error() != "sreq: bad status: 400" || err.Unwrap() != nil {
+		t.Error("StatusError test failed")
+	}
+
+	err.Err = io.ErrUnexpectedEOF
+	if err.Error() != "sreq: bad status: 400, decode failure: unexpected EOF" || err.Unwrap() != io.ErrUnexpectedEOF {
+		t.Error("StatusError test failed")
+	}
+}
@@ -3,6 +3,10 @@ module github.com/lhmwzy/sreq
 go 1.13
 
 require (
+	github.com/klauspost/compress v1.12.3
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	golang.org/x/net v0.0.0-20191009170851-d66e71096ffb
+	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
 	golang.org/x/text v0.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
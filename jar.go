@@ -0,0 +1,175 @@
+package sreq
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	stdurl "net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+type (
+	// FileCookieJar is an http.CookieJar which can persist its cookies to a file as JSON,
+	// useful for keeping sessions between runs.
+	// Session cookies, i.e. those without expiry, are persisted as well.
+	FileCookieJar struct {
+		path    string
+		jar     *cookiejar.Jar
+		mu      sync.Mutex
+		entries map[string]*fileCookie
+	}
+
+	fileCookie struct {
+		URL      string    `json:"url"`
+		Name     string    `json:"name"`
+		Value    string    `json:"value"`
+		Domain   string    `json:"domain,omitempty"`
+		Path     string    `json:"path,omitempty"`
+		Expires  time.Time `json:"expires"`
+		Secure   bool      `json:"secure,omitempty"`
+		HttpOnly bool      `json:"http_only,omitempty"`
+	}
+)
+
+// NewFileCookieJar returns a new FileCookieJar backed by the named file,
+// cookies will be loaded from it if it exists.
+func NewFileCookieJar(path string) (*FileCookieJar, error) {
+	jar, _ := cookiejar.New(&cookiejar.Options{
+		PublicSuffixList: publicsuffix.List,
+	})
+	fj := &FileCookieJar{
+		path:    path,
+		jar:     jar,
+		entries: make(map[string]*fileCookie),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fj, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*fileCookie
+	if err = json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		if !e.Expires.IsZero() && !e.Expires.After(now) {
+			continue
+		}
+
+		u, err := stdurl.Parse(e.URL)
+		if err != nil {
+			return nil, err
+		}
+		fj.SetCookies(u, []*http.Cookie{e.cookie()})
+	}
+	return fj, nil
+}
+
+// SetCookies implements the SetCookies method of the http.CookieJar interface.
+func (fj *FileCookieJar) SetCookies(u *stdurl.URL, cookies []*http.Cookie) {
+	fj.jar.SetCookies(u, cookies)
+
+	fj.mu.Lock()
+	defer fj.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		e := &fileCookie{
+			URL:      (&stdurl.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String(),
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+		if c.MaxAge > 0 {
+			e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		}
+
+		key := cookieKey(u, c)
+		if c.MaxAge < 0 || (!e.Expires.IsZero() && !e.Expires.After(now)) {
+			delete(fj.entries, key)
+			continue
+		}
+		fj.entries[key] = e
+	}
+}
+
+// Cookies implements the Cookies method of the http.CookieJar interface.
+func (fj *FileCookieJar) Cookies(u *stdurl.URL) []*http.Cookie {
+	return fj.jar.Cookies(u)
+}
+
+// Save saves the unexpired cookies of fj into its file.
+func (fj *FileCookieJar) Save() error {
+	fj.mu.Lock()
+	keys := make([]string, 0, len(fj.entries))
+	for k := range fj.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	now := time.Now()
+	entries := make([]*fileCookie, 0, len(keys))
+	for _, k := range keys {
+		e := fj.entries[k]
+		if !e.Expires.IsZero() && !e.Expires.After(now) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	fj.mu.Unlock()
+
+	b, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fj.path, b, 0600)
+}
+
+func (e *fileCookie) cookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     e.Name,
+		Value:    e.Value,
+		Domain:   e.Domain,
+		Path:     e.Path,
+		Expires:  e.Expires,
+		Secure:   e.Secure,
+		HttpOnly: e.HttpOnly,
+	}
+}
+
+func cookieKey(u *stdurl.URL, c *http.Cookie) string {
+	domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+	if domain == "" {
+		domain = strings.ToLower(u.Hostname())
+	}
+
+	path := c.Path
+	if path == "" || path[0] != '/' {
+		path = u.Path
+		if i := strings.LastIndex(path, "/"); i > 0 {
+			path = path[:i]
+		} else {
+			path = "/"
+		}
+	}
+
+	return domain + ";" + path + ";" + c.Name
+}
@@ -0,0 +1,85 @@
+package sreq_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/winterssy/sreq"
+)
+
+func TestFileCookieJar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sreq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cookies.json")
+	jar, err := sreq.NewFileCookieJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse("https://www.example.com/account/login")
+	jar.SetCookies(u, []*http.Cookie{
+		{
+			Name:     "session",
+			Value:    "s1",
+			Domain:   "example.com",
+			Path:     "/account",
+			Expires:  time.Now().Add(time.Hour),
+			Secure:   true,
+			HttpOnly: true,
+		},
+		{
+			Name:  "lang",
+			Value: "en",
+		},
+		{
+			Name:    "expired",
+			Value:   "v",
+			Expires: time.Now().Add(-time.Hour),
+		},
+	})
+	if err = jar.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(b), `"http_only": true`) || strings.Contains(string(b), "expired") {
+		t.Errorf("FileCookieJar saved unexpected content: %s", b)
+	}
+
+	jar, err = sreq.NewFileCookieJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://api.example.com/account/profile", "session=s1"},
+		{"http://api.example.com/account/profile", ""},
+		{"https://api.example.com/", ""},
+		{"https://www.example.com/account/logout", "session=s1; lang=en"},
+		{"https://api.example.com/account", "session=s1"},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		cookies := jar.Cookies(u)
+		values := make([]string, len(cookies))
+		for i, c := range cookies {
+			values[i] = c.String()
+		}
+		if got := strings.Join(values, "; "); got != test.want {
+			t.Errorf("FileCookieJar cookies for %s got: %q, want: %q", test.url, got, test.want)
+		}
+	}
+}
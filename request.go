@@ -3,8 +3,11 @@ package sreq
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -13,8 +16,15 @@ import (
 	"net/http"
 	"net/textproto"
 	stdurl "net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/net/http/httpguts"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -52,10 +62,29 @@ type (
 		RawRequest *http.Request
 		Err        error
 
-		getBody       func() io.Reader
-		timeout       time.Duration
-		retry         *retry
-		errBackground chan error
+		getBody           func() io.Reader
+		replayBody        func() (io.ReadCloser, error)
+		form              stdurl.Values
+		timeout           time.Duration
+		retry             *retry
+		retryMaxDuration  time.Duration
+		retryHook         func(attempt int, req *Request)
+		acceptStatus      []int
+		multipartProgress func(written int64)
+		trace             *clientTrace
+		contextValues     []contextValue
+		errBackground     chan error
+		multipartFiles    map[string][]*File
+		multipartForm     KV
+		tags              map[string]string
+		querySeparator    string
+		authScheme        string
+		authConflict      bool
+	}
+
+	contextValue struct {
+		key interface{}
+		val interface{}
 	}
 
 	// RequestOption specifies a request options, like params, form, etc.
@@ -65,6 +94,14 @@ type (
 	RequestInterceptor func(*Request) error
 )
 
+var autoUserAgent = true
+
+// SetAutoUserAgent controls whether NewRequest sets the default User-Agent header value, default true.
+// It should be called before making any requests since it's not concurrent safe.
+func SetAutoUserAgent(enabled bool) {
+	autoUserAgent = enabled
+}
+
 func (req *Request) raiseError(cause string, err error) {
 	req.Err = &RequestError{
 		Cause: cause,
@@ -81,7 +118,9 @@ func NewRequest(method string, url string) *Request {
 		return req
 	}
 
-	rawRequest.Header.Set("User-Agent", defaultUserAgent)
+	if autoUserAgent {
+		rawRequest.Header.Set("User-Agent", defaultUserAgent)
+	}
 	req.RawRequest = rawRequest
 	return req
 }
@@ -91,13 +130,94 @@ func (req *Request) Raw() (*http.Request, error) {
 	return req.RawRequest, req.Err
 }
 
+// Clone returns a deep copy of the HTTP request, used to build requests from a base one.
+// Its headers, URL, payload, timeout, retry policy, tags and so on can be modified
+// without affecting the original one.
+// Notes: The payload must be replayable, such as the one set by SetJSON, SetForm, etc.
+// A stream payload, e.g. by SetBody with an *os.File, or by SetMultipart, will be shared.
+func (req *Request) Clone() *Request {
+	clone := new(Request)
+	*clone = *req
+	if req.RawRequest == nil {
+		return clone
+	}
+
+	rawRequest := new(http.Request)
+	*rawRequest = *req.RawRequest
+	rawRequest.Header = cloneHeader(req.RawRequest.Header)
+	rawRequest.Trailer = cloneHeader(req.RawRequest.Trailer)
+	if req.RawRequest.URL != nil {
+		u := new(stdurl.URL)
+		*u = *req.RawRequest.URL
+		rawRequest.URL = u
+	}
+	if req.RawRequest.GetBody != nil {
+		if body, err := req.RawRequest.GetBody(); err == nil {
+			rawRequest.Body = body
+		}
+	}
+	clone.RawRequest = rawRequest
+
+	if req.form != nil {
+		clone.form = make(stdurl.Values, len(req.form))
+		for k, v := range req.form {
+			clone.form[k] = append([]string(nil), v...)
+		}
+	}
+	if req.retry != nil {
+		retry := *req.retry
+		clone.retry = &retry
+	}
+	if req.trace != nil {
+		clone.trace = new(clientTrace)
+	}
+	clone.contextValues = append([]contextValue(nil), req.contextValues...)
+	if req.tags != nil {
+		clone.tags = make(map[string]string, len(req.tags))
+		for k, v := range req.tags {
+			clone.tags[k] = v
+		}
+	}
+	return clone
+}
+
+func cloneHeader(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+
+	h2 := make(http.Header, len(h))
+	for k, v := range h {
+		h2[k] = append([]string(nil), v...)
+	}
+	return h2
+}
+
+// SetMethod sets method for the HTTP request.
+func (req *Request) SetMethod(method string) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	if !httpguts.ValidHeaderFieldName(method) {
+		req.raiseError("SetMethod", fmt.Errorf("invalid method %q", method))
+		return req
+	}
+
+	req.RawRequest.Method = method
+	return req
+}
+
 // SetBody sets body for the HTTP request.
 // Notes: SetBody does not support retry since it's unable to read a stream twice.
+// Use SetGetBody to make it replayable.
 func (req *Request) SetBody(body io.Reader) *Request {
 	if req.Err != nil {
 		return req
 	}
 
+	req.multipartFiles, req.multipartForm = nil, nil
+	req.replayBody = nil
 	rc, ok := body.(io.ReadCloser)
 	if !ok && body != nil {
 		rc = ioutil.NopCloser(body)
@@ -151,6 +271,48 @@ func (req *Request) SetBody(body io.Reader) *Request {
 	return req
 }
 
+// SetGetBody sets fn to return a new copy of the body set by SetBody,
+// so that the HTTP request can be retried and redirected with its body.
+// It must be called after the body is set, otherwise a *RequestError will be raised.
+func (req *Request) SetGetBody(fn func() (io.ReadCloser, error)) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	if req.RawRequest.Body == nil || req.RawRequest.Body == http.NoBody {
+		req.raiseError("SetGetBody", ErrNilBody)
+		return req
+	}
+
+	req.replayBody = fn
+	req.RawRequest.GetBody = fn
+	return req
+}
+
+// SetStreamingUpload sets a streaming payload for the HTTP request, optimized for large uploads over slow links.
+// The payload is sent using chunked transfer encoding with "Expect: 100-continue",
+// so the server can reject it before the body is sent.
+// Notes: SetStreamingUpload does not support retry since it's unable to read a stream twice.
+func (req *Request) SetStreamingUpload(r io.Reader, contentType string) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	if r == nil {
+		req.raiseError("SetStreamingUpload", ErrNilBody)
+		return req
+	}
+
+	// Hide the concrete type of r so that SetBody won't make it replayable.
+	req.getBody = nil
+	req.SetBody(struct{ io.Reader }{r})
+	req.RawRequest.ContentLength = -1
+	req.RawRequest.GetBody = nil
+	req.RawRequest.TransferEncoding = []string{"chunked"}
+	req.RawRequest.Header.Set("Expect", "100-continue")
+	return req.SetContentType(contentType)
+}
+
 // SetHost sets host for the HTTP request.
 func (req *Request) SetHost(host string) *Request {
 	if req.Err != nil {
@@ -161,13 +323,99 @@ func (req *Request) SetHost(host string) *Request {
 	return req
 }
 
+// SetEscapedPath sets URL path for the HTTP request that joined by segments,
+// each segment will be percent-encoded, including slashes within it.
+func (req *Request) SetEscapedPath(segments ...string) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = stdurl.PathEscape(segment)
+	}
+
+	req.RawRequest.URL.Path = "/" + strings.Join(segments, "/")
+	req.RawRequest.URL.RawPath = "/" + strings.Join(escaped, "/")
+	return req
+}
+
+// pathParamRegexp matches the "{name}" placeholders in the escaped URL path.
+var pathParamRegexp = regexp.MustCompile(`(?i)%7B([\w.-]+)%7D`)
+
+// SetPathParams substitutes the "{name}" placeholders in URL path for the HTTP request
+// with the values of params, each value will be percent-encoded, including slashes within it.
+// It raises a *RequestError if a placeholder is left unfilled or a param has no placeholder.
+func (req *Request) SetPathParams(params map[string]string) *Request {
+	return req.setPathParams("SetPathParams", params, true)
+}
+
+// SetPathParamsLenient is like SetPathParams, but the unfilled placeholders and the unused params are ignored.
+func (req *Request) SetPathParamsLenient(params map[string]string) *Request {
+	return req.setPathParams("SetPathParamsLenient", params, false)
+}
+
+func (req *Request) setPathParams(cause string, params map[string]string, strict bool) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	used := make(map[string]bool, len(params))
+	missing := false
+	u := req.RawRequest.URL
+	// Substitute all placeholders in one pass, so that a value containing a placeholder won't be filled again.
+	escaped := pathParamRegexp.ReplaceAllStringFunc(u.EscapedPath(), func(placeholder string) string {
+		name := placeholder[3 : len(placeholder)-3]
+		v, ok := params[name]
+		if !ok {
+			missing = true
+			return placeholder
+		}
+
+		used[name] = true
+		return stdurl.PathEscape(v)
+	})
+	if strict && missing {
+		req.raiseError(cause, ErrMissingPathParam)
+		return req
+	}
+	if strict && len(used) != len(params) {
+		req.raiseError(cause, ErrUnusedPathParam)
+		return req
+	}
+
+	path, err := stdurl.PathUnescape(escaped)
+	if err != nil {
+		req.raiseError(cause, err)
+		return req
+	}
+
+	u.Path, u.RawPath = path, escaped
+	return req
+}
+
 // SetHeaders sets headers for the HTTP request.
+// It raises a *RequestError if any header field name or value contains illegal characters, such as CR or LF.
 func (req *Request) SetHeaders(headers KV) *Request {
 	if req.Err != nil {
 		return req
 	}
 
-	for _, k := range headers.Keys() {
+	keys := headers.Keys()
+	for _, k := range keys {
+		if !httpguts.ValidHeaderFieldName(k) {
+			req.raiseError("SetHeaders", ErrInvalidHeader)
+			return req
+		}
+		for _, v := range headers.Get(k) {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				req.raiseError("SetHeaders", ErrInvalidHeader)
+				return req
+			}
+		}
+	}
+
+	for _, k := range keys {
 		for _, v := range headers.Get(k) {
 			req.RawRequest.Header.Add(k, v)
 		}
@@ -176,33 +424,99 @@ func (req *Request) SetHeaders(headers KV) *Request {
 	return req
 }
 
-// SetContentType sets Content-Type header value for the HTTP request.
-func (req *Request) SetContentType(contentType string) *Request {
+// SetHeader sets header for the HTTP request, it replaces any existing values associated with key,
+// while SetHeaders adds to them.
+// It raises a *RequestError if the header field name or value contains illegal characters, such as CR or LF.
+func (req *Request) SetHeader(key string, value string) *Request {
 	if req.Err != nil {
 		return req
 	}
 
-	req.RawRequest.Header.Set("Content-Type", contentType)
-	return req
+	if !httpguts.ValidHeaderFieldName(key) {
+		req.raiseError("SetHeader", ErrInvalidHeader)
+		return req
+	}
+	return req.setHeader("SetHeader", key, value)
 }
 
-// SetUserAgent sets User-Agent header value for the HTTP request.
-func (req *Request) SetUserAgent(userAgent string) *Request {
+// DelHeader deletes the values associated with key from the headers of the HTTP request.
+func (req *Request) DelHeader(key string) *Request {
 	if req.Err != nil {
 		return req
 	}
 
-	req.RawRequest.Header.Set("User-Agent", userAgent)
+	req.RawRequest.Header.Del(key)
 	return req
 }
 
+// SetContentType sets Content-Type header value for the HTTP request.
+func (req *Request) SetContentType(contentType string) *Request {
+	return req.setHeader("SetContentType", "Content-Type", contentType)
+}
+
+// SetUserAgent sets User-Agent header value for the HTTP request.
+func (req *Request) SetUserAgent(userAgent string) *Request {
+	return req.setHeader("SetUserAgent", "User-Agent", userAgent)
+}
+
 // SetReferer sets Referer header value for the HTTP request.
 func (req *Request) SetReferer(referer string) *Request {
+	return req.setHeader("SetReferer", "Referer", referer)
+}
+
+// SetAcceptLanguage sets Accept-Language header value for the HTTP request.
+func (req *Request) SetAcceptLanguage(langs string) *Request {
+	return req.setHeader("SetAcceptLanguage", "Accept-Language", langs)
+}
+
+// SetContentLanguage sets Content-Language header value for the HTTP request.
+func (req *Request) SetContentLanguage(lang string) *Request {
+	return req.setHeader("SetContentLanguage", "Content-Language", lang)
+}
+
+// SetAcceptCharset sets Accept-Charset header value for the HTTP request.
+func (req *Request) SetAcceptCharset(charset string) *Request {
+	return req.setHeader("SetAcceptCharset", "Accept-Charset", charset)
+}
+
+// SetIfMatch sets If-Match header value for the HTTP request, used for optimistic concurrency control.
+// The etag should be quoted as the server returned it, e.g. `"xyzzy"`.
+// If the resource has been modified, the server will respond with status code 412.
+func (req *Request) SetIfMatch(etag string) *Request {
+	return req.setHeader("SetIfMatch", "If-Match", etag)
+}
+
+// SetPriority sets Priority header value for the HTTP request as defined in RFC 9218,
+// urgency ranges from 0 (highest) to 7 (lowest), incremental reports whether
+// the response can be processed incrementally.
+func (req *Request) SetPriority(urgency int, incremental bool) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	if urgency < 0 || urgency > 7 {
+		req.raiseError("SetPriority", fmt.Errorf("invalid urgency %d, must be in range 0-7", urgency))
+		return req
+	}
+
+	priority := "u=" + strconv.Itoa(urgency)
+	if incremental {
+		priority += ", i"
+	}
+	return req.setHeader("SetPriority", "Priority", priority)
+}
+
+func (req *Request) setHeader(cause string, key string, value string) *Request {
 	if req.Err != nil {
 		return req
 	}
 
-	req.RawRequest.Header.Set("Referer", referer)
+	if !httpguts.ValidHeaderFieldValue(value) {
+		req.raiseError(cause, ErrInvalidHeader)
+		return req
+	}
+
+	req.RawRequest.Header.Set(key, value)
 	return req
 }
 
@@ -214,7 +528,12 @@ func (req *Request) SetQuery(params KV) *Request {
 
 	query := req.RawRequest.URL.Query()
 	for _, k := range params.Keys() {
-		for _, v := range params.Get(k) {
+		vs := params.Get(k)
+		if req.querySeparator != "" && len(vs) > 1 {
+			query.Add(k, strings.Join(vs, req.querySeparator))
+			continue
+		}
+		for _, v := range vs {
 			query.Add(k, v)
 		}
 	}
@@ -223,6 +542,58 @@ func (req *Request) SetQuery(params KV) *Request {
 	return req
 }
 
+// SetRawQuery appends the pre-encoded query string q, e.g. "a=1&sig=abc%2F", to the query of the HTTP request
+// verbatim, so that signature-sensitive params keep their encoding.
+// Notes: SetQuery re-encodes the whole query, call SetRawQuery after it rather than before.
+func (req *Request) SetRawQuery(q string) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	q = strings.TrimPrefix(q, "?")
+	if q == "" {
+		return req
+	}
+
+	url := req.RawRequest.URL
+	if url.RawQuery == "" {
+		url.RawQuery = q
+	} else {
+		url.RawQuery += "&" + q
+	}
+	return req
+}
+
+// SetQueryArraySeparator makes the subsequent SetQuery and SetQueryStruct join multiple values of a key
+// with sep into a single value, e.g. "key=a|b|c" for "|", rather than encoding them as repeated keys.
+// An empty sep restores the repeated keys.
+func (req *Request) SetQueryArraySeparator(sep string) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	req.querySeparator = sep
+	return req
+}
+
+// SetQueryStruct sets query params for the HTTP request from a struct or a pointer to struct.
+// The key of each field is specified by its "url" or "json" tag, or the field name if none,
+// a tag of "-" skips the field and the "omitempty" option skips the field if it has a zero value.
+// Slice and array fields are encoded as repeated keys.
+func (req *Request) SetQueryStruct(v interface{}) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	params, err := structToValues(v, "url", "json")
+	if err != nil {
+		req.raiseError("SetQueryStruct", err)
+		return req
+	}
+
+	return req.SetQuery(params)
+}
+
 // SetContent sets bytes payload for the HTTP request.
 func (req *Request) SetContent(content []byte) *Request {
 	if req.Err != nil {
@@ -262,6 +633,48 @@ func (req *Request) SetForm(form KV) *Request {
 		}
 	}
 
+	return req.setFormBody(data)
+}
+
+// SetFormStruct sets form payload for the HTTP request from a struct or a pointer to struct.
+// The key of each field is specified by its "url" or "form" tag, or the field name if none,
+// a tag of "-" skips the field and the "omitempty" option skips the field if it has a zero value.
+// Slice and array fields are encoded as repeated keys.
+func (req *Request) SetFormStruct(v interface{}) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	form, err := structToValues(v, "url", "form")
+	if err != nil {
+		req.raiseError("SetFormStruct", err)
+		return req
+	}
+
+	return req.SetForm(form)
+}
+
+// AddFormField appends a field to the form payload set by SetForm or AddFormField for the HTTP request,
+// value supports the same data types as Values.
+// If there isn't a form payload yet, a new one will be created.
+func (req *Request) AddFormField(key string, value interface{}) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	data := req.form
+	if data == nil {
+		data = make(stdurl.Values)
+	}
+	for _, v := range filter(value) {
+		data.Add(key, v)
+	}
+
+	return req.setFormBody(data)
+}
+
+func (req *Request) setFormBody(data stdurl.Values) *Request {
+	req.form = data
 	s := data.Encode()
 	req.getBody = func() io.Reader {
 		return strings.NewReader(s)
@@ -289,6 +702,29 @@ func (req *Request) SetJSON(data interface{}, escapeHTML bool) *Request {
 	return req
 }
 
+// SetEmptyJSON sets an empty JSON object, i.e. "{}", as payload for the HTTP request.
+// It's useful for the APIs that reject a request without a JSON payload even if there's no data.
+func (req *Request) SetEmptyJSON() *Request {
+	return req.setRawJSON([]byte("{}"))
+}
+
+// SetEmptyJSONArray sets an empty JSON array, i.e. "[]", as payload for the HTTP request.
+func (req *Request) SetEmptyJSONArray() *Request {
+	return req.setRawJSON([]byte("[]"))
+}
+
+func (req *Request) setRawJSON(b []byte) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	req.getBody = func() io.Reader {
+		return bytes.NewReader(b)
+	}
+	req.SetContentType("application/json")
+	return req
+}
+
 // SetXML sets XML payload for the HTTP request.
 func (req *Request) SetXML(data interface{}) *Request {
 	if req.Err != nil {
@@ -308,83 +744,307 @@ func (req *Request) SetXML(data interface{}) *Request {
 	return req
 }
 
+// SetYAML sets YAML payload for the HTTP request.
+func (req *Request) SetYAML(data interface{}) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	b, err := yaml.Marshal(data)
+	if err != nil {
+		req.raiseError("SetYAML", err)
+		return req
+	}
+
+	req.getBody = func() io.Reader {
+		return bytes.NewReader(b)
+	}
+	req.SetContentType("application/x-yaml")
+	return req
+}
+
+// SetMsgpack sets MessagePack payload for the HTTP request.
+func (req *Request) SetMsgpack(data interface{}) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	b, err := msgpackMarshal(data)
+	if err != nil {
+		req.raiseError("SetMsgpack", err)
+		return req
+	}
+
+	req.getBody = func() io.Reader {
+		return bytes.NewReader(b)
+	}
+	req.SetContentType("application/msgpack")
+	return req
+}
+
 var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
 
 func escapeQuotes(s string) string {
 	return quoteEscaper.Replace(s)
 }
 
-func setFiles(mw *multipart.Writer, files Files) error {
+type filePart struct {
+	field string
+	file  *File
+	r     *bufio.Reader
+	mime  string
+}
+
+// prepareFiles checks the files and detects their MIME types if not specified.
+func prepareFiles(files map[string][]*File) ([]*filePart, error) {
+	var parts []*filePart
+	for k, vs := range files {
+		for _, v := range vs {
+			if v.Filename == "" {
+				return nil, fmt.Errorf("filename of [%s] not specified", k)
+			}
+
+			r := bufio.NewReader(v)
+			cType := v.MIME
+			if cType == "" {
+				data, _ := r.Peek(512)
+				cType = http.DetectContentType(data)
+			}
+			parts = append(parts, &filePart{
+				field: k,
+				file:  v,
+				r:     r,
+				mime:  cType,
+			})
+		}
+	}
+
+	return parts, nil
+}
+
+func (fp *filePart) header() textproto.MIMEHeader {
 	const (
 		fileFormat = `form-data; name="%s"; filename="%s"`
 	)
 
-	var (
-		part io.Writer
-		err  error
-	)
-	for k, v := range files {
-		filename := v.Filename
-		if filename == "" {
-			return fmt.Errorf("filename of [%s] not specified", k)
-		}
-
-		r := bufio.NewReader(v)
-		cType := v.MIME
-		if cType == "" {
-			data, _ := r.Peek(512)
-			cType = http.DetectContentType(data)
-		}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition",
+		fmt.Sprintf(fileFormat, escapeQuotes(fp.field), escapeQuotes(fp.file.Filename)))
+	h.Set("Content-Type", fp.mime)
+	return h
+}
 
-		h := make(textproto.MIMEHeader)
-		h.Set("Content-Disposition",
-			fmt.Sprintf(fileFormat, escapeQuotes(k), escapeQuotes(filename)))
-		h.Set("Content-Type", cType)
-		part, err = mw.CreatePart(h)
+func setFiles(mw *multipart.Writer, parts []*filePart, onWrite func(n int)) error {
+	for _, fp := range parts {
+		part, err := mw.CreatePart(fp.header())
 		if err != nil {
 			return err
 		}
 
-		_, err = io.Copy(part, r)
+		_, err = io.Copy(&progressWriter{w: part, onWrite: onWrite}, fp.r)
 		if err != nil {
 			return err
 		}
 
-		v.Close()
+		fp.file.Close()
 	}
 
 	return nil
 }
 
-func setForm(mw *multipart.Writer, form KV) {
-	for _, k := range form.Keys() {
-		for _, v := range form.Get(k) {
-			mw.WriteField(k, v)
+// replayMultipart returns a func which writes the multipart payload of parts and form again,
+// delimited by boundary, or nil if any file can't be reopened.
+func replayMultipart(boundary string, parts []*filePart, form KV) func() (io.ReadCloser, error) {
+	for _, fp := range parts {
+		if fp.file.path == "" {
+			return nil
 		}
 	}
-}
 
-// SetMultipart sets multipart payload for the HTTP request.
-// Notes: SetMultipart does not support retry since it's unable to read a stream twice.
-func (req *Request) SetMultipart(files Files, form KV) *Request {
-	if req.Err != nil {
-		return req
-	}
+	return func() (io.ReadCloser, error) {
+		replayed := make([]*filePart, 0, len(parts))
+		for _, fp := range parts {
+			file, err := os.Open(fp.file.path)
+			if err != nil {
+				for _, p := range replayed {
+					p.file.Close()
+				}
+				return nil, err
+			}
 
-	req.errBackground = make(chan error, 1)
-	ctx, cancel := context.WithCancel(req.RawRequest.Context())
-	req.RawRequest = req.RawRequest.WithContext(ctx)
+			f := *fp.file
+			f.Body = file
+			replayed = append(replayed, &filePart{
+				field: fp.field,
+				file:  &f,
+				r:     bufio.NewReader(file),
+				mime:  fp.mime,
+			})
+		}
+
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		mw.SetBoundary(boundary)
+		go func() {
+			err := setFiles(mw, replayed, func(int) {})
+			if err == nil && form != nil {
+				setForm(mw, form)
+			}
+			if err == nil {
+				err = mw.Close()
+			}
+			for _, fp := range replayed {
+				fp.file.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		return pr, nil
+	}
+}
+
+// multipartLength returns the length of the multipart payload written by mw,
+// ok reports whether the sizes of all files are known.
+func multipartLength(mw *multipart.Writer, parts []*filePart, form KV) (n int64, ok bool) {
+	cw := new(countWriter)
+	w := multipart.NewWriter(cw)
+	w.SetBoundary(mw.Boundary())
+	for _, fp := range parts {
+		if fp.file.Size <= 0 {
+			return 0, false
+		}
+
+		w.CreatePart(fp.header())
+		n += fp.file.Size
+	}
+
+	if form != nil {
+		setForm(w, form)
+	}
+	w.Close()
+	return n + cw.n, true
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	cw.n += int64(len(p))
+	return len(p), nil
+}
+
+type progressWriter struct {
+	w       io.Writer
+	onWrite func(n int)
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.onWrite(n)
+	return n, err
+}
+
+func setForm(mw *multipart.Writer, form KV) {
+	for _, k := range form.Keys() {
+		for _, v := range form.Get(k) {
+			mw.WriteField(k, v)
+		}
+	}
+}
+
+// SetMultipart sets multipart payload for the HTTP request.
+// If writing the payload fails, the request will be aborted with a *RequestError,
+// which has priority over the timeout error if they occur nearly at the same time.
+// Notes: SetMultipart does not support retry since it's unable to read a stream twice,
+// unless the sizes of all files are known and they're opened by Open, MustOpen or FilesFromDir.
+func (req *Request) SetMultipart(files Files, form KV) *Request {
+	var multiFiles map[string][]*File
+	if files != nil {
+		multiFiles = make(map[string][]*File, len(files))
+		for k, v := range files {
+			multiFiles[k] = []*File{v}
+		}
+	}
+	return req.setMultipart("SetMultipart", multiFiles, form)
+}
+
+// SetMultipartMulti is like SetMultipart, but allows multiple files under the same field name,
+// each file will be sent as a part with the shared name, e.g. "files[]".
+// Notes: SetMultipartMulti does not support retry since it's unable to read a stream twice,
+// unless the sizes of all files are known and they're opened by Open, MustOpen or FilesFromDir.
+func (req *Request) SetMultipartMulti(files map[string][]*File, form KV) *Request {
+	return req.setMultipart("SetMultipartMulti", files, form)
+}
+
+// SetRawMultipart sets a pre-built multipart payload for the HTTP request,
+// whose parts are delimited by boundary, and sets Content-Type header value accordingly.
+// An invalid boundary will raise a *RequestError.
+func (req *Request) SetRawMultipart(body io.Reader, boundary string) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	mw := multipart.NewWriter(ioutil.Discard)
+	if err := mw.SetBoundary(boundary); err != nil {
+		req.raiseError("SetRawMultipart", err)
+		return req
+	}
+
+	req.SetBody(body)
+	return req.SetContentType(mw.FormDataContentType())
+}
+
+func (req *Request) setMultipart(cause string, files map[string][]*File, form KV) *Request {
+	if req.Err != nil {
+		return req
+	}
 
 	pr, pw := io.Pipe()
 	mw := multipart.NewWriter(pw)
-	go func() {
+
+	// If the sizes of all files are known, prepare them in advance to compute the Content-Length.
+	var parts []*filePart
+	contentLength, knownLength := int64(0), true
+	for _, vs := range files {
+		for _, v := range vs {
+			knownLength = knownLength && v.Size > 0
+		}
+	}
+	if knownLength {
+		var err error
+		parts, err = prepareFiles(files)
+		if err != nil {
+			req.raiseError(cause, err)
+			return req
+		}
+		contentLength, knownLength = multipartLength(mw, parts, form)
+	}
+
+	req.errBackground = make(chan error, 1)
+	ctx, cancel := context.WithCancel(req.RawRequest.Context())
+	req.RawRequest = req.RawRequest.WithContext(ctx)
+
+	go func(parts []*filePart) {
 		defer pw.Close()
 		defer mw.Close()
 
-		err := setFiles(mw, files)
+		var err error
+		if parts == nil {
+			parts, err = prepareFiles(files)
+		}
+		if err == nil {
+			var written int64
+			err = setFiles(mw, parts, func(n int) {
+				written += int64(n)
+				// It's safe to read the callback here since the write has been consumed by the request.
+				if cb := req.multipartProgress; cb != nil {
+					cb(written)
+				}
+			})
+		}
 		if err != nil {
 			req.errBackground <- &RequestError{
-				Cause: "SetMultipart",
+				Cause: cause,
 				Err:   err,
 			}
 			cancel()
@@ -394,13 +1054,108 @@ func (req *Request) SetMultipart(files Files, form KV) *Request {
 		if form != nil {
 			setForm(mw, form)
 		}
-	}()
+	}(parts)
 
 	req.SetBody(pr)
+	if knownLength {
+		req.RawRequest.ContentLength = contentLength
+		if replay := replayMultipart(mw.Boundary(), parts, form); replay != nil {
+			req.replayBody = replay
+			req.RawRequest.GetBody = replay
+		}
+	}
+	req.multipartFiles, req.multipartForm = files, form
 	req.SetContentType(mw.FormDataContentType())
 	return req
 }
 
+// backgroundErrorGracePeriod is how long to wait for the background error of a request,
+// e.g. a multipart payload failed to write, after its context is done.
+const backgroundErrorGracePeriod = 50 * time.Millisecond
+
+// backgroundError determines the error of a request whose context is done.
+// The background *RequestError has priority over ctxErr if it's raised in time,
+// i.e. before or within backgroundErrorGracePeriod after the context is done,
+// since it's the root cause of the cancellation, or races with the timeout.
+// Otherwise, or if it's caused by the aborted request itself, ctxErr is returned.
+func (req *Request) backgroundError(ctxErr error) error {
+	if req.errBackground == nil {
+		return ctxErr
+	}
+
+	var err error
+	select {
+	case err = <-req.errBackground:
+	default:
+		timer := time.NewTimer(backgroundErrorGracePeriod)
+		defer timer.Stop()
+		select {
+		case err = <-req.errBackground:
+		case <-timer.C:
+			return ctxErr
+		}
+	}
+
+	// Writing to the closed pipe is a consequence of the aborted request, not the cause.
+	if reqErr, ok := err.(*RequestError); ok && reqErr.Err == io.ErrClosedPipe {
+		return ctxErr
+	}
+	return err
+}
+
+// SetMultipartProgress sets a callback to report the progress of writing the files of the multipart payload
+// set by SetMultipart or SetMultipartMulti, written is the cumulative number of bytes written so far.
+func (req *Request) SetMultipartProgress(cb func(written int64)) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	req.multipartProgress = cb
+	return req
+}
+
+// EnableBodyCompression gzip-compresses the current payload for the HTTP request
+// and sets Content-Encoding header value to "gzip".
+// It must be called after the payload is set, otherwise a *RequestError will be raised.
+func (req *Request) EnableBodyCompression() *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	var body io.Reader
+	switch {
+	case req.getBody != nil:
+		body = req.getBody()
+	case req.RawRequest.Body != nil && req.RawRequest.Body != http.NoBody:
+		body = req.RawRequest.Body
+	default:
+		req.raiseError("EnableBodyCompression", ErrNilBody)
+		return req
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := io.Copy(zw, body)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		req.raiseError("EnableBodyCompression", err)
+		return req
+	}
+
+	b := buf.Bytes()
+	if req.getBody != nil {
+		req.getBody = func() io.Reader {
+			return bytes.NewReader(b)
+		}
+	} else {
+		req.SetBody(bytes.NewReader(b))
+	}
+	req.RawRequest.Header.Set("Content-Encoding", "gzip")
+	return req
+}
+
 // SetCookies sets cookies for the HTTP request.
 func (req *Request) SetCookies(cookies ...*http.Cookie) *Request {
 	if req.Err != nil {
@@ -413,6 +1168,19 @@ func (req *Request) SetCookies(cookies ...*http.Cookie) *Request {
 	return req
 }
 
+// SetCookieString sets cookies for the HTTP request from a raw Cookie header value,
+// such as "n1=v1; n2=v2" copied from the browser, malformed pairs are ignored.
+func (req *Request) SetCookieString(raw string) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	header := http.Header{}
+	header.Set("Cookie", raw)
+	cookies := (&http.Request{Header: header}).Cookies()
+	return req.SetCookies(cookies...)
+}
+
 func basicAuth(username, password string) string {
 	auth := username + ":" + password
 	return base64.StdEncoding.EncodeToString([]byte(auth))
@@ -424,7 +1192,7 @@ func (req *Request) SetBasicAuth(username string, password string) *Request {
 		return req
 	}
 
-	req.RawRequest.Header.Set("Authorization", "Basic "+basicAuth(username, password))
+	req.setAuthorization("Basic", basicAuth(username, password))
 	return req
 }
 
@@ -434,11 +1202,26 @@ func (req *Request) SetBearerToken(token string) *Request {
 		return req
 	}
 
-	req.RawRequest.Header.Set("Authorization", "Bearer "+token)
+	req.setAuthorization("Bearer", token)
 	return req
 }
 
+// setAuthorization sets Authorization header value for the HTTP request,
+// and records a conflict if another scheme has been applied, see Client.SetStrictAuth.
+func (req *Request) setAuthorization(scheme string, credentials string) {
+	if req.authScheme != "" && req.authScheme != scheme {
+		req.authConflict = true
+	}
+	req.authScheme = scheme
+	if credentials == "" {
+		req.RawRequest.Header.Set("Authorization", scheme)
+		return
+	}
+	req.RawRequest.Header.Set("Authorization", scheme+" "+credentials)
+}
+
 // SetContext sets context for the HTTP request.
+// The values set by SetContextValue will be carried to ctx.
 func (req *Request) SetContext(ctx context.Context) *Request {
 	if req.Err != nil {
 		return req
@@ -449,6 +1232,23 @@ func (req *Request) SetContext(ctx context.Context) *Request {
 		return req
 	}
 
+	for _, cv := range req.contextValues {
+		ctx = context.WithValue(ctx, cv.key, cv.val)
+	}
+	req.RawRequest = req.RawRequest.WithContext(ctx)
+	return req
+}
+
+// SetContextValue derives the context of the HTTP request with the value associated with key,
+// so that the request interceptors and transports can access it.
+// The value will be carried even if the context is replaced by SetContext later.
+func (req *Request) SetContextValue(key interface{}, val interface{}) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	req.contextValues = append(req.contextValues, contextValue{key: key, val: val})
+	ctx := context.WithValue(req.RawRequest.Context(), key, val)
 	req.RawRequest = req.RawRequest.WithContext(ctx)
 	return req
 }
@@ -481,14 +1281,289 @@ func (req *Request) SetRetry(attempts int, delay time.Duration,
 	return req
 }
 
+// SetRetryMaxDuration caps the cumulative time spent on the attempts and delays of the retry policy
+// for the HTTP request.
+// If the next attempt can't be made within d, the retry will be aborted with ErrRetryMaxDurationExceeded.
+func (req *Request) SetRetryMaxDuration(d time.Duration) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	req.retryMaxDuration = d
+	return req
+}
+
+// SetAcceptStatus marks the status codes as acceptable outcomes of the HTTP request,
+// the retry policy stops once the HTTP response has one of them, even if its conditions report to retry.
+// Notes: It only affects the retry policy, EnsureStatus and the like still check the status code as is,
+// use EnsureStatusIn to accept them in a chain.
+func (req *Request) SetAcceptStatus(codes ...int) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	req.acceptStatus = codes
+	return req
+}
+
+func (req *Request) isAcceptStatus(code int) bool {
+	for _, c := range req.acceptStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRetryHook sets a hook called before each retry of the HTTP request,
+// attempt is the number of the retry starting from 1, and req can be mutated,
+// e.g. to refresh a token or bump a nonce, before it's sent again.
+func (req *Request) SetRetryHook(fn func(attempt int, req *Request)) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	req.retryHook = fn
+	return req
+}
+
+// SetTag sets a tag for the HTTP request, which isn't sent to the server
+// but can be read by interceptors, proxy selectors and so on, e.g. for routing or metrics.
+func (req *Request) SetTag(key string, value string) *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	if req.tags == nil {
+		req.tags = make(map[string]string)
+	}
+	req.tags[key] = value
+	return req
+}
+
+// Tag returns the tag value of the HTTP request associated with key,
+// ok reports whether the tag is present.
+func (req *Request) Tag(key string) (value string, ok bool) {
+	value, ok = req.tags[key]
+	return
+}
+
+// EnableTrace makes the HTTP request collect its timing metrics,
+// which can be retrieved by calling the Trace method of its response.
+func (req *Request) EnableTrace() *Request {
+	if req.Err != nil {
+		return req
+	}
+
+	req.trace = new(clientTrace)
+	return req
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// ToCurl returns the curl command line equivalent to the HTTP request, used for sharing reproductions.
+// The payload is rendered with "--data", except the multipart one which is rendered with "-F".
+// Notes: ToCurl returns an error if the payload is a stream that cannot be read twice.
+func (req *Request) ToCurl() (string, error) {
+	if req.Err != nil {
+		return "", req.Err
+	}
+
+	rawRequest := req.RawRequest
+	multipartBody := req.getBody == nil && (req.multipartFiles != nil || req.multipartForm != nil)
+
+	var sb strings.Builder
+	sb.WriteString("curl -X ")
+	sb.WriteString(shellQuote(rawRequest.Method))
+	sb.WriteString(" ")
+	sb.WriteString(shellQuote(rawRequest.URL.String()))
+
+	if rawRequest.Host != "" && rawRequest.Host != rawRequest.URL.Host {
+		sb.WriteString(" -H ")
+		sb.WriteString(shellQuote("Host: " + rawRequest.Host))
+	}
+
+	keys := make([]string, 0, len(rawRequest.Header))
+	for k := range rawRequest.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// curl generates the boundary of the multipart payload itself.
+		if multipartBody && k == "Content-Type" {
+			continue
+		}
+
+		for _, v := range rawRequest.Header[k] {
+			if k == "Cookie" {
+				sb.WriteString(" -b ")
+				sb.WriteString(shellQuote(v))
+				continue
+			}
+
+			sb.WriteString(" -H ")
+			sb.WriteString(shellQuote(k + ": " + v))
+		}
+	}
+
+	if multipartBody {
+		for _, k := range sortedFileKeys(req.multipartFiles) {
+			for _, f := range req.multipartFiles[k] {
+				field := k + "=@" + f.Filename
+				if f.MIME != "" {
+					field += ";type=" + f.MIME
+				}
+				sb.WriteString(" -F ")
+				sb.WriteString(shellQuote(field))
+			}
+		}
+		if req.multipartForm != nil {
+			for _, k := range req.multipartForm.Keys() {
+				for _, v := range req.multipartForm.Get(k) {
+					sb.WriteString(" -F ")
+					sb.WriteString(shellQuote(k + "=" + v))
+				}
+			}
+		}
+		return sb.String(), nil
+	}
+
+	var body io.Reader
+	switch {
+	case req.getBody != nil:
+		body = req.getBody()
+	case rawRequest.GetBody != nil:
+		rc, err := rawRequest.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		body = rc
+	case rawRequest.Body != nil && rawRequest.Body != http.NoBody:
+		return "", ErrStreamBody
+	}
+
+	if body != nil {
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			return "", err
+		}
+		if len(b) != 0 {
+			sb.WriteString(" --data ")
+			sb.WriteString(shellQuote(string(b)))
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// volatileHeaders are excluded when computing the fingerprint of an HTTP request,
+// since they are likely to vary between equivalent requests.
+var volatileHeaders = map[string]bool{
+	"Date":             true,
+	"Expect":           true,
+	"Traceparent":      true,
+	"Tracestate":       true,
+	"X-Correlation-Id": true,
+	"X-Request-Id":     true,
+}
+
+// Fingerprint returns a stable hash of the HTTP request, computed over its method, URL, headers and payload,
+// which can be used as a key for caching or deduplication.
+// Volatile headers, i.e. Date, Expect, Traceparent, Tracestate, X-Correlation-Id and X-Request-Id, are excluded.
+// Notes: If the payload is a stream that cannot be read twice, it's not taken into account.
+// It returns an empty string if req.Err is set.
+func (req *Request) Fingerprint() string {
+	if req.Err != nil || req.RawRequest == nil {
+		return ""
+	}
+
+	rawRequest := req.RawRequest
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", rawRequest.Method, rawRequest.URL.String())
+	if rawRequest.Host != "" {
+		fmt.Fprintf(h, "Host: %s\n", rawRequest.Host)
+	}
+
+	keys := make([]string, 0, len(rawRequest.Header))
+	for k := range rawRequest.Header {
+		if !volatileHeaders[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range rawRequest.Header[k] {
+			fmt.Fprintf(h, "%s: %s\n", k, v)
+		}
+	}
+	h.Write([]byte("\n"))
+
+	var body io.Reader
+	switch {
+	case req.getBody != nil:
+		body = req.getBody()
+	case rawRequest.GetBody != nil:
+		if rc, err := rawRequest.GetBody(); err == nil {
+			defer rc.Close()
+			body = rc
+		}
+	}
+	if body != nil {
+		bh := sha256.New()
+		io.Copy(bh, body)
+		h.Write(bh.Sum(nil))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sortedFileKeys(files map[string][]*File) []string {
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WithMethod sets method for the HTTP request.
+func WithMethod(method string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetMethod(method)
+	}
+}
+
 // WithBody sets body for the HTTP request.
 // Notes: WithBody does not support retry since it's unable to read a stream twice.
+// Use WithGetBody to make it replayable.
 func WithBody(body io.Reader) RequestOption {
 	return func(req *Request) *Request {
 		return req.SetBody(body)
 	}
 }
 
+// WithGetBody sets fn to return a new copy of the body set by WithBody,
+// so that the HTTP request can be retried and redirected with its body.
+// It must be applied after the body is set, otherwise a *RequestError will be raised.
+func WithGetBody(fn func() (io.ReadCloser, error)) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetGetBody(fn)
+	}
+}
+
+// WithStreamingUpload sets a streaming payload for the HTTP request, optimized for large uploads over slow links.
+// The payload is sent using chunked transfer encoding with "Expect: 100-continue",
+// so the server can reject it before the body is sent.
+// Notes: WithStreamingUpload does not support retry since it's unable to read a stream twice.
+func WithStreamingUpload(r io.Reader, contentType string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetStreamingUpload(r, contentType)
+	}
+}
+
 // WithHost sets host for the HTTP request.
 func WithHost(host string) RequestOption {
 	return func(req *Request) *Request {
@@ -496,6 +1571,30 @@ func WithHost(host string) RequestOption {
 	}
 }
 
+// WithEscapedPath sets URL path for the HTTP request that joined by segments,
+// each segment will be percent-encoded, including slashes within it.
+func WithEscapedPath(segments ...string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetEscapedPath(segments...)
+	}
+}
+
+// WithPathParams substitutes the "{name}" placeholders in URL path for the HTTP request
+// with the values of params, each value will be percent-encoded, including slashes within it.
+// It raises a *RequestError if a placeholder is left unfilled or a param has no placeholder.
+func WithPathParams(params map[string]string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetPathParams(params)
+	}
+}
+
+// WithPathParamsLenient is like WithPathParams, but the unfilled placeholders and the unused params are ignored.
+func WithPathParamsLenient(params map[string]string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetPathParamsLenient(params)
+	}
+}
+
 // WithHeaders sets headers for the HTTP request.
 func WithHeaders(headers KV) RequestOption {
 	return func(req *Request) *Request {
@@ -503,6 +1602,22 @@ func WithHeaders(headers KV) RequestOption {
 	}
 }
 
+// WithHeader sets header for the HTTP request, it replaces any existing values associated with key,
+// while WithHeaders adds to them.
+// It raises a *RequestError if the header field name or value contains illegal characters, such as CR or LF.
+func WithHeader(key string, value string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetHeader(key, value)
+	}
+}
+
+// WithoutHeader deletes the values associated with key from the headers of the HTTP request.
+func WithoutHeader(key string) RequestOption {
+	return func(req *Request) *Request {
+		return req.DelHeader(key)
+	}
+}
+
 // WithContentType sets Content-Type header value for the HTTP request.
 func WithContentType(contentType string) RequestOption {
 	return func(req *Request) *Request {
@@ -524,6 +1639,45 @@ func WithReferer(referer string) RequestOption {
 	}
 }
 
+// WithAcceptLanguage sets Accept-Language header value for the HTTP request.
+func WithAcceptLanguage(langs string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetAcceptLanguage(langs)
+	}
+}
+
+// WithContentLanguage sets Content-Language header value for the HTTP request.
+func WithContentLanguage(lang string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetContentLanguage(lang)
+	}
+}
+
+// WithAcceptCharset sets Accept-Charset header value for the HTTP request.
+func WithAcceptCharset(charset string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetAcceptCharset(charset)
+	}
+}
+
+// WithIfMatch sets If-Match header value for the HTTP request, used for optimistic concurrency control.
+// The etag should be quoted as the server returned it, e.g. `"xyzzy"`.
+// If the resource has been modified, the server will respond with status code 412.
+func WithIfMatch(etag string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetIfMatch(etag)
+	}
+}
+
+// WithPriority sets Priority header value for the HTTP request as defined in RFC 9218,
+// urgency ranges from 0 (highest) to 7 (lowest), incremental reports whether
+// the response can be processed incrementally.
+func WithPriority(urgency int, incremental bool) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetPriority(urgency, incremental)
+	}
+}
+
 // WithQuery sets query params for the HTTP request.
 func WithQuery(params KV) RequestOption {
 	return func(req *Request) *Request {
@@ -531,6 +1685,32 @@ func WithQuery(params KV) RequestOption {
 	}
 }
 
+// WithRawQuery appends the pre-encoded query string q, e.g. "a=1&sig=abc%2F", to the query of the HTTP request
+// verbatim, so that signature-sensitive params keep their encoding.
+// Notes: WithQuery re-encodes the whole query, apply WithRawQuery after it rather than before.
+func WithRawQuery(q string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetRawQuery(q)
+	}
+}
+
+// WithQueryArraySeparator makes the subsequent WithQuery and WithQueryStruct join multiple values of a key
+// with sep into a single value, e.g. "key=a|b|c" for "|", rather than encoding them as repeated keys.
+// An empty sep restores the repeated keys.
+func WithQueryArraySeparator(sep string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetQueryArraySeparator(sep)
+	}
+}
+
+// WithQueryStruct sets query params for the HTTP request from a struct or a pointer to struct.
+// See Request.SetQueryStruct for details.
+func WithQueryStruct(v interface{}) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetQueryStruct(v)
+	}
+}
+
 // WithContent sets bytes payload for the HTTP request.
 func WithContent(content []byte) RequestOption {
 	return func(req *Request) *Request {
@@ -552,6 +1732,21 @@ func WithForm(form KV) RequestOption {
 	}
 }
 
+// WithFormStruct sets form payload for the HTTP request from a struct or a pointer to struct.
+// See Request.SetFormStruct for details.
+func WithFormStruct(v interface{}) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetFormStruct(v)
+	}
+}
+
+// WithFormField appends a field to the form payload for the HTTP request.
+func WithFormField(key string, value interface{}) RequestOption {
+	return func(req *Request) *Request {
+		return req.AddFormField(key, value)
+	}
+}
+
 // WithJSON sets JSON payload for the HTTP request.
 func WithJSON(data interface{}, escapeHTML bool) RequestOption {
 	return func(req *Request) *Request {
@@ -559,6 +1754,21 @@ func WithJSON(data interface{}, escapeHTML bool) RequestOption {
 	}
 }
 
+// WithEmptyJSON sets an empty JSON object, i.e. "{}", as payload for the HTTP request.
+// It's useful for the APIs that reject a request without a JSON payload even if there's no data.
+func WithEmptyJSON() RequestOption {
+	return func(req *Request) *Request {
+		return req.SetEmptyJSON()
+	}
+}
+
+// WithEmptyJSONArray sets an empty JSON array, i.e. "[]", as payload for the HTTP request.
+func WithEmptyJSONArray() RequestOption {
+	return func(req *Request) *Request {
+		return req.SetEmptyJSONArray()
+	}
+}
+
 // WithXML sets XML payload for the HTTP request.
 func WithXML(data interface{}) RequestOption {
 	return func(req *Request) *Request {
@@ -566,7 +1776,23 @@ func WithXML(data interface{}) RequestOption {
 	}
 }
 
+// WithYAML sets YAML payload for the HTTP request.
+func WithYAML(data interface{}) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetYAML(data)
+	}
+}
+
+// WithMsgpack sets MessagePack payload for the HTTP request.
+func WithMsgpack(data interface{}) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetMsgpack(data)
+	}
+}
+
 // WithMultipart sets multipart payload for the HTTP request.
+// If writing the payload fails, the request will be aborted with a *RequestError,
+// which has priority over the timeout error if they occur nearly at the same time.
 // Notes: WithMultipart does not support retry since it's unable to read a stream twice.
 func WithMultipart(files Files, form KV) RequestOption {
 	return func(req *Request) *Request {
@@ -574,6 +1800,41 @@ func WithMultipart(files Files, form KV) RequestOption {
 	}
 }
 
+// WithMultipartMulti is like WithMultipart, but allows multiple files under the same field name,
+// each file will be sent as a part with the shared name, e.g. "files[]".
+// Notes: WithMultipartMulti does not support retry since it's unable to read a stream twice.
+func WithMultipartMulti(files map[string][]*File, form KV) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetMultipartMulti(files, form)
+	}
+}
+
+// WithRawMultipart sets a pre-built multipart payload for the HTTP request,
+// whose parts are delimited by boundary, and sets Content-Type header value accordingly.
+// An invalid boundary will raise a *RequestError.
+func WithRawMultipart(body io.Reader, boundary string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetRawMultipart(body, boundary)
+	}
+}
+
+// WithMultipartProgress sets a callback to report the progress of writing the files of the multipart payload
+// set by WithMultipart or WithMultipartMulti, written is the cumulative number of bytes written so far.
+func WithMultipartProgress(cb func(written int64)) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetMultipartProgress(cb)
+	}
+}
+
+// WithGzipBody gzip-compresses the current payload for the HTTP request
+// and sets Content-Encoding header value to "gzip".
+// It must be applied after the payload options, otherwise a *RequestError will be raised.
+func WithGzipBody() RequestOption {
+	return func(req *Request) *Request {
+		return req.EnableBodyCompression()
+	}
+}
+
 // WithCookies appends cookies for the HTTP request.
 func WithCookies(cookies ...*http.Cookie) RequestOption {
 	return func(req *Request) *Request {
@@ -581,6 +1842,14 @@ func WithCookies(cookies ...*http.Cookie) RequestOption {
 	}
 }
 
+// WithCookieString sets cookies for the HTTP request from a raw Cookie header value,
+// such as "n1=v1; n2=v2" copied from the browser, malformed pairs are ignored.
+func WithCookieString(raw string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetCookieString(raw)
+	}
+}
+
 // WithBasicAuth sets basic authentication for the HTTP request.
 func WithBasicAuth(username string, password string) RequestOption {
 	return func(req *Request) *Request {
@@ -602,6 +1871,15 @@ func WithContext(ctx context.Context) RequestOption {
 	}
 }
 
+// WithContextValue derives the context of the HTTP request with the value associated with key,
+// so that the request interceptors and transports can access it.
+// The value will be carried even if the context is replaced by WithContext later.
+func WithContextValue(key interface{}, val interface{}) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetContextValue(key, val)
+	}
+}
+
 // WithTimeout sets timeout for the HTTP request.
 func WithTimeout(timeout time.Duration) RequestOption {
 	return func(req *Request) *Request {
@@ -617,3 +1895,47 @@ func WithRetry(attempts int, delay time.Duration,
 		return req.SetRetry(attempts, delay, conditions...)
 	}
 }
+
+// WithRetryMaxDuration caps the cumulative time spent on the attempts and delays of the retry policy
+// for the HTTP request.
+// If the next attempt can't be made within d, the retry will be aborted with ErrRetryMaxDurationExceeded.
+func WithRetryMaxDuration(d time.Duration) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetRetryMaxDuration(d)
+	}
+}
+
+// WithAcceptStatus marks the status codes as acceptable outcomes of the HTTP request,
+// the retry policy stops once the HTTP response has one of them, even if its conditions report to retry.
+// Notes: It only affects the retry policy, EnsureStatus and the like still check the status code as is,
+// use EnsureStatusIn to accept them in a chain.
+func WithAcceptStatus(codes ...int) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetAcceptStatus(codes...)
+	}
+}
+
+// WithRetryHook sets a hook called before each retry of the HTTP request,
+// attempt is the number of the retry starting from 1, and req can be mutated,
+// e.g. to refresh a token or bump a nonce, before it's sent again.
+func WithRetryHook(fn func(attempt int, req *Request)) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetRetryHook(fn)
+	}
+}
+
+// WithTag sets a tag for the HTTP request, which isn't sent to the server
+// but can be read by interceptors, proxy selectors and so on, e.g. for routing or metrics.
+func WithTag(key string, value string) RequestOption {
+	return func(req *Request) *Request {
+		return req.SetTag(key, value)
+	}
+}
+
+// WithTrace makes the HTTP request collect its timing metrics,
+// which can be retrieved by calling the Trace method of its response.
+func WithTrace() RequestOption {
+	return func(req *Request) *Request {
+		return req.EnableTrace()
+	}
+}
@@ -2,15 +2,19 @@ package sreq_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/xml"
 	"errors"
+	"io"
 	"io/ioutil"
 	"math"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -67,6 +71,48 @@ func TestNewRequest(t *testing.T) {
 	}
 }
 
+func TestRequest_SetMethod(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	req := sreq.
+		NewRequest(sreq.MethodGet, ts.URL).
+		SetMethod(sreq.MethodPut)
+	data, err := client.
+		Do(req).
+		EnsureStatusOk().
+		Text()
+	if err != nil || data != sreq.MethodPut {
+		t.Errorf("Request_SetMethod got: %q, want: %q", data, sreq.MethodPut)
+	}
+
+	_, err = sreq.
+		NewRequest(sreq.MethodGet, ts.URL).
+		SetMethod("@").
+		Raw()
+	if _, ok := err.(*sreq.RequestError); !ok {
+		t.Error("Request_SetMethod test failed")
+	}
+}
+
+func TestSetAutoUserAgent(t *testing.T) {
+	req := sreq.NewRequest(sreq.MethodGet, "http://127.0.0.1")
+	if req.RawRequest.Header.Get("User-Agent") == "" {
+		t.Error("SetAutoUserAgent test failed")
+	}
+
+	sreq.SetAutoUserAgent(false)
+	defer sreq.SetAutoUserAgent(true)
+
+	req = sreq.NewRequest(sreq.MethodGet, "http://127.0.0.1")
+	if _, ok := req.RawRequest.Header["User-Agent"]; ok {
+		t.Error("SetAutoUserAgent test failed")
+	}
+}
+
 func TestWithBody(t *testing.T) {
 	body := bytes.NewBuffer([]byte{})
 	client := sreq.New()
@@ -153,6 +199,56 @@ func TestWithHeaders(t *testing.T) {
 	}
 }
 
+func TestWithHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join(r.Header["Accept"], ",") + ";" + strings.Join(r.Header["X-Custom"], ",")))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		opts []sreq.RequestOption
+		want string
+	}{
+		{
+			opts: []sreq.RequestOption{
+				sreq.WithHeaders(sreq.Headers{"Accept": "text/plain"}),
+				sreq.WithHeaders(sreq.Headers{"Accept": "application/json"}),
+			},
+			want: "text/plain,application/json;",
+		},
+		{
+			opts: []sreq.RequestOption{
+				sreq.WithHeaders(sreq.Headers{"Accept": "text/plain"}),
+				sreq.WithHeader("Accept", "application/json"),
+			},
+			want: "application/json;",
+		},
+		{
+			opts: []sreq.RequestOption{
+				sreq.WithHeader("Accept", "application/json"),
+				sreq.WithHeaders(sreq.Headers{"X-Custom": []string{"1", "2"}}),
+				sreq.WithoutHeader("x-custom"),
+			},
+			want: "application/json;",
+		},
+	}
+	for _, test := range tests {
+		data, err := sreq.Get(ts.URL, test.opts...).EnsureStatusOk().Text()
+		if err != nil || data != test.want {
+			t.Errorf("WithHeader got: %q, want: %q", data, test.want)
+		}
+	}
+
+	req := sreq.NewRequest(sreq.MethodGet, ts.URL).SetHeader("Bad Key", "value")
+	if req.Err == nil {
+		t.Error("WithHeader test failed")
+	}
+	req = sreq.NewRequest(sreq.MethodGet, ts.URL).SetHeader("Key", "bad\r\nvalue")
+	if req.Err == nil {
+		t.Error("WithHeader test failed")
+	}
+}
+
 func TestWithUserAgent(t *testing.T) {
 	type response struct {
 		Headers map[string]string `json:"headers"`
@@ -654,3 +750,991 @@ func TestWithRetry(t *testing.T) {
 		t.Error("context should have priority over the retry policy")
 	}
 }
+
+func TestWithAcceptLanguage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Accept-Language") + "|" +
+			r.Header.Get("Content-Language") + "|" + r.Header.Get("Accept-Charset")))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	data, err := client.
+		Get(ts.URL,
+			sreq.WithAcceptLanguage("zh-CN,en;q=0.8"),
+			sreq.WithContentLanguage("en-US"),
+			sreq.WithAcceptCharset("utf-8"),
+		).
+		EnsureStatusOk().
+		Text()
+	if want := "zh-CN,en;q=0.8|en-US|utf-8"; err != nil || data != want {
+		t.Errorf("WithAcceptLanguage got: %q, want: %q", data, want)
+	}
+
+	_, err = client.
+		Get(ts.URL,
+			sreq.WithAcceptLanguage("en\r\nX-Injected: 1"),
+		).
+		Raw()
+	reqErr, ok := err.(*sreq.RequestError)
+	if !ok || reqErr.Unwrap() != sreq.ErrInvalidHeader {
+		t.Error("WithAcceptLanguage test failed")
+	}
+}
+
+func TestRequest_InvalidHeader(t *testing.T) {
+	const (
+		injection = "foo\r\nX: y"
+	)
+
+	reqs := []*sreq.Request{
+		sreq.NewRequest(sreq.MethodGet, "http://127.0.0.1").
+			SetHeaders(sreq.Headers{"X-Test": injection}),
+		sreq.NewRequest(sreq.MethodGet, "http://127.0.0.1").
+			SetHeaders(sreq.Headers{"X-Test\r\n": "foo"}),
+		sreq.NewRequest(sreq.MethodGet, "http://127.0.0.1").
+			SetContentType(injection),
+		sreq.NewRequest(sreq.MethodGet, "http://127.0.0.1").
+			SetUserAgent(injection),
+		sreq.NewRequest(sreq.MethodGet, "http://127.0.0.1").
+			SetReferer(injection),
+	}
+	for i, req := range reqs {
+		rawRequest, err := req.Raw()
+		reqErr, ok := err.(*sreq.RequestError)
+		if !ok || reqErr.Unwrap() != sreq.ErrInvalidHeader {
+			t.Errorf("Request_InvalidHeader test case %d failed", i)
+			continue
+		}
+		if rawRequest.Header.Get("X-Test") != "" {
+			t.Errorf("Request_InvalidHeader test case %d failed", i)
+		}
+	}
+}
+
+func TestWithEscapedPath(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.EscapedPath()))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	data, err := client.
+		Get(ts.URL,
+			sreq.WithEscapedPath("files", "a/b c", "你好"),
+		).
+		EnsureStatusOk().
+		Text()
+	if want := "/files/a%2Fb%20c/%E4%BD%A0%E5%A5%BD"; err != nil || data != want {
+		t.Errorf("WithEscapedPath got: %q, want: %q", data, want)
+	}
+}
+
+func TestWithEmptyJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" || r.ContentLength != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	data, err := sreq.Post(ts.URL, sreq.WithEmptyJSON()).EnsureStatusOk().Text()
+	if err != nil || data != "{}" {
+		t.Errorf("WithEmptyJSON got: %q, want: %q", data, "{}")
+	}
+
+	data, err = sreq.Post(ts.URL, sreq.WithEmptyJSONArray()).EnsureStatusOk().Text()
+	if err != nil || data != "[]" {
+		t.Errorf("WithEmptyJSON got: %q, want: %q", data, "[]")
+	}
+
+	req := sreq.NewRequest(sreq.MethodPost, ts.URL).SetEmptyJSON()
+	err = sreq.New().
+		SetRequestSigner(func(r *http.Request) error {
+			if r.GetBody == nil {
+				return errors.New("GetBody not set")
+			}
+			return nil
+		}).
+		Do(req).
+		EnsureStatusOk().
+		Error()
+	if err != nil {
+		t.Errorf("WithEmptyJSON got: %v, want GetBody set", err)
+	}
+}
+
+func TestWithPathParams(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.EscapedPath()))
+	}))
+	defer ts.Close()
+
+	data, err := sreq.
+		Get(ts.URL+"/users/{id}/posts/{postID}",
+			sreq.WithPathParams(map[string]string{
+				"id":     "a/b c",
+				"postID": "2019",
+			}),
+		).
+		EnsureStatusOk().
+		Text()
+	if want := "/users/a%2Fb%20c/posts/2019"; err != nil || data != want {
+		t.Errorf("WithPathParams got: %q, want: %q", data, want)
+	}
+
+	req := sreq.NewRequest(sreq.MethodGet, ts.URL+"/users/{id}/posts/{postID}").
+		SetPathParams(map[string]string{"id": "{postID}", "postID": "a/b"})
+	if want := "/users/%7BpostID%7D/posts/a%2Fb"; req.Err != nil || req.RawRequest.URL.EscapedPath() != want {
+		t.Errorf("WithPathParams got: %q, error: %v, want: %q", req.RawRequest.URL.EscapedPath(), req.Err, want)
+	}
+
+	req = sreq.NewRequest(sreq.MethodGet, ts.URL+"/users/{id}/posts/{postID}").
+		SetPathParams(map[string]string{"id": "1"})
+	if reqErr, ok := req.Err.(*sreq.RequestError); !ok || reqErr.Err != sreq.ErrMissingPathParam {
+		t.Errorf("WithPathParams got: %v, want: %v", req.Err, sreq.ErrMissingPathParam)
+	}
+
+	req = sreq.NewRequest(sreq.MethodGet, ts.URL+"/users/{id}").
+		SetPathParams(map[string]string{"id": "1", "postID": "2019"})
+	if reqErr, ok := req.Err.(*sreq.RequestError); !ok || reqErr.Err != sreq.ErrUnusedPathParam {
+		t.Errorf("WithPathParams got: %v, want: %v", req.Err, sreq.ErrUnusedPathParam)
+	}
+
+	req = sreq.NewRequest(sreq.MethodGet, ts.URL+"/users/{id}").
+		SetPathParamsLenient(map[string]string{"id": "1", "postID": "2019"})
+	if req.Err != nil || req.RawRequest.URL.Path != "/users/1" {
+		t.Errorf("WithPathParams got: %q, error: %v, want: %q", req.RawRequest.URL.Path, req.Err, "/users/1")
+	}
+}
+
+func TestRequest_AddFormField(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.ParseForm()
+		w.Write([]byte(r.PostForm.Encode()))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	data, err := client.
+		Put(ts.URL,
+			sreq.WithForm(sreq.Form{
+				"k1": "v1",
+			}),
+			sreq.WithFormField("k2", "v2"),
+			sreq.WithFormField("k3", []int{1, 2}),
+			sreq.WithFormField("k1", "v3"),
+		).
+		EnsureStatusOk().
+		Text()
+	if want := "k1=v1&k1=v3&k2=v2&k3=1&k3=2"; err != nil || data != want {
+		t.Errorf("Request_AddFormField got: %q, want: %q", data, want)
+	}
+
+	req := sreq.
+		NewRequest(sreq.MethodPatch, ts.URL).
+		AddFormField("k1", "v1").
+		AddFormField("k2", 2)
+	data, err = client.
+		Do(req).
+		EnsureStatusOk().
+		Text()
+	if want := "k1=v1&k2=2"; err != nil || data != want {
+		t.Errorf("Request_AddFormField got: %q, want: %q", data, want)
+	}
+}
+
+func TestWithGzipBody(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.Copy(w, zr)
+	}))
+	defer ts.Close()
+
+	payload := map[string]interface{}{
+		"msg": strings.Repeat("hello world", 100),
+	}
+	client := sreq.New()
+	h, err := client.
+		Post(ts.URL,
+			sreq.WithJSON(payload, false),
+			sreq.WithGzipBody(),
+			sreq.WithRetry(2, 10*time.Millisecond, sreq.RetryOnStatus(http.StatusServiceUnavailable)),
+		).
+		EnsureStatusOk().
+		H()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.GetString("msg") != payload["msg"] || attempts != 2 {
+		t.Error("WithGzipBody test failed")
+	}
+
+	_, err = client.
+		Post(ts.URL,
+			sreq.WithGzipBody(),
+		).
+		Raw()
+	reqErr, ok := err.(*sreq.RequestError)
+	if !ok || reqErr.Unwrap() != sreq.ErrNilBody {
+		t.Error("WithGzipBody test failed")
+	}
+}
+
+func TestWithQueryArraySeparator(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		w.Write([]byte(strings.Join(q["key"], ",") + ";" + strings.Join(q["other"], ",")))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		opts []sreq.RequestOption
+		want string
+	}{
+		{
+			opts: []sreq.RequestOption{
+				sreq.WithQuery(sreq.Params{"key": []string{"a", "b", "c"}}),
+			},
+			want: "a,b,c;",
+		},
+		{
+			opts: []sreq.RequestOption{
+				sreq.WithQueryArraySeparator("|"),
+				sreq.WithQuery(sreq.Params{"key": []string{"a", "b", "c"}, "other": "d"}),
+			},
+			want: "a|b|c;d",
+		},
+		{
+			opts: []sreq.RequestOption{
+				sreq.WithQueryArraySeparator("~"),
+				sreq.WithQuery(sreq.Params{"key": []string{"a", "b"}}),
+				sreq.WithQueryArraySeparator(""),
+				sreq.WithQuery(sreq.Params{"other": []string{"c", "d"}}),
+			},
+			want: "a~b;c,d",
+		},
+	}
+	for _, test := range tests {
+		data, err := sreq.Get(ts.URL, test.opts...).EnsureStatusOk().Text()
+		if err != nil || data != test.want {
+			t.Errorf("WithQueryArraySeparator got: %q, want: %q", data, test.want)
+		}
+	}
+}
+
+func TestWithFormStruct(t *testing.T) {
+	type form struct {
+		Username string   `form:"username"`
+		Password string   `url:"password"`
+		Scopes   []string `form:"scope"`
+		Remember bool     `form:"remember,omitempty"`
+		Ignored  string   `form:"-"`
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.ParseForm()
+		w.Write([]byte(r.PostForm.Encode()))
+	}))
+	defer ts.Close()
+
+	data, err := sreq.
+		Post(ts.URL,
+			sreq.WithFormStruct(&form{
+				Username: "admin",
+				Password: "p@ss",
+				Scopes:   []string{"read", "write"},
+				Ignored:  "ignored",
+			}),
+		).
+		EnsureStatusOk().
+		Text()
+	if want := "password=p%40ss&scope=read&scope=write&username=admin"; err != nil || data != want {
+		t.Errorf("WithFormStruct got: %q, want: %q", data, want)
+	}
+
+	req := sreq.NewRequest(sreq.MethodPost, ts.URL).SetFormStruct(1)
+	if req.Err == nil {
+		t.Error("WithFormStruct test failed")
+	}
+}
+
+func TestWithRawQuery(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		client *sreq.Client
+		opts   []sreq.RequestOption
+		want   string
+	}{
+		{
+			client: sreq.New(),
+			opts: []sreq.RequestOption{
+				sreq.WithRawQuery("?sig=a%2Fb+c&b=2"),
+			},
+			want: "sig=a%2Fb+c&b=2",
+		},
+		{
+			client: sreq.New(),
+			opts: []sreq.RequestOption{
+				sreq.WithQuery(sreq.Params{"key": "a b"}),
+				sreq.WithRawQuery("sig=a%2Fb+c"),
+			},
+			want: "key=a+b&sig=a%2Fb+c",
+		},
+		{
+			client: sreq.New().SetDefaultQuery(sreq.Params{"key": "secret", "sig": "ignored"}),
+			opts: []sreq.RequestOption{
+				sreq.WithRawQuery("sig=a%2Fb+c"),
+			},
+			want: "sig=a%2Fb+c&key=secret",
+		},
+	}
+	for _, test := range tests {
+		data, err := test.client.Get(ts.URL, test.opts...).EnsureStatusOk().Text()
+		if err != nil || data != test.want {
+			t.Errorf("WithRawQuery got: %q, want: %q", data, test.want)
+		}
+	}
+}
+
+func TestWithQueryStruct(t *testing.T) {
+	type Paging struct {
+		Page int `url:"page,omitempty"`
+		Size int `json:"size"`
+	}
+
+	type query struct {
+		Paging
+		Keyword  string    `url:"q"`
+		Tags     []string  `url:"tag"`
+		IDs      []int     `json:"id,omitempty"`
+		Lang     string    `url:"lang,omitempty"`
+		Verified *bool     `url:"verified,omitempty"`
+		Ignored  string    `url:"-"`
+		Since    time.Time `url:"since,omitempty"`
+		Score    float64
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer ts.Close()
+
+	verified := true
+	client := sreq.New()
+	data, err := client.
+		Get(ts.URL,
+			sreq.WithQueryStruct(&query{
+				Keyword:  "hello world",
+				Tags:     []string{"a", "b"},
+				IDs:      []int{1, 2},
+				Verified: &verified,
+				Ignored:  "ignored",
+				Score:    3.5,
+			}),
+		).
+		EnsureStatusOk().
+		Text()
+	if want := "Score=3.5&id=1&id=2&q=hello+world&size=0&tag=a&tag=b&verified=true"; err != nil || data != want {
+		t.Errorf("WithQueryStruct got: %q, want: %q", data, want)
+	}
+
+	_, err = client.
+		Get(ts.URL,
+			sreq.WithQueryStruct("hello world"),
+		).
+		Raw()
+	if _, ok := err.(*sreq.RequestError); !ok {
+		t.Error("WithQueryStruct test failed")
+	}
+}
+
+func TestWithContextValue(t *testing.T) {
+	type ctxKey struct{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var got []interface{}
+	client := sreq.New().UseRequestInterceptors(func(req *sreq.Request) error {
+		got = append(got, req.RawRequest.Context().Value(ctxKey{}))
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client.Get(ts.URL,
+		sreq.WithContext(ctx),
+		sreq.WithContextValue(ctxKey{}, "v1"),
+	)
+	client.Get(ts.URL,
+		sreq.WithContextValue(ctxKey{}, "v2"),
+		sreq.WithContext(ctx),
+	)
+	if !reflect.DeepEqual(got, []interface{}{"v1", "v2"}) {
+		t.Errorf("WithContextValue got: %v, want: %v", got, []interface{}{"v1", "v2"})
+	}
+}
+
+func TestWithStreamingUpload(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if len(r.TransferEncoding) == 0 || r.TransferEncoding[0] != "chunked" ||
+			r.Header.Get("Expect") != "100-continue" ||
+			r.Header.Get("Content-Type") != "application/octet-stream" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	data, err := client.
+		Put(ts.URL,
+			sreq.WithStreamingUpload(bytes.NewReader([]byte("hello world")), "application/octet-stream"),
+			sreq.WithRetry(3, 10*time.Millisecond, sreq.RetryOnStatus(http.StatusServiceUnavailable)),
+		).
+		EnsureStatus(http.StatusServiceUnavailable).
+		Text()
+	if err != nil || data != "hello world" {
+		t.Errorf("WithStreamingUpload got: %q, want: %q", data, "hello world")
+	}
+	if attempts != 1 {
+		t.Errorf("WithStreamingUpload got attempts: %d, want: %d", attempts, 1)
+	}
+}
+
+func TestWithGetBody(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := ioutil.ReadAll(r.Body)
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	// Hide the concrete type of the reader so that WithBody won't make it replayable.
+	newBody := func() io.Reader {
+		return struct{ io.Reader }{strings.NewReader("hello world")}
+	}
+	client := sreq.New()
+	data, err := client.
+		Post(ts.URL,
+			sreq.WithBody(newBody()),
+			sreq.WithGetBody(func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(newBody()), nil
+			}),
+			sreq.WithRetry(3, 10*time.Millisecond, sreq.RetryOnStatus(http.StatusServiceUnavailable)),
+		).
+		EnsureStatusOk().
+		Text()
+	if err != nil || data != "hello world" {
+		t.Errorf("WithGetBody got: %q, want: %q", data, "hello world")
+	}
+	if attempts != 3 {
+		t.Errorf("WithGetBody got attempts: %d, want: %d", attempts, 3)
+	}
+
+	errReplay := errors.New("replay failed")
+	attempts = 0
+	err = client.
+		Post(ts.URL,
+			sreq.WithBody(newBody()),
+			sreq.WithGetBody(func() (io.ReadCloser, error) {
+				return nil, errReplay
+			}),
+			sreq.WithRetry(3, 10*time.Millisecond, sreq.RetryOnStatus(http.StatusServiceUnavailable)),
+		).
+		Error()
+	if reqErr, ok := err.(*sreq.RequestError); !ok || reqErr.Err != errReplay {
+		t.Errorf("WithGetBody got: %v, want: %v", err, errReplay)
+	}
+
+	err = client.
+		Post(ts.URL,
+			sreq.WithGetBody(func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(newBody()), nil
+			}),
+		).
+		Error()
+	if reqErr, ok := err.(*sreq.RequestError); !ok || reqErr.Err != sreq.ErrNilBody {
+		t.Errorf("WithGetBody got: %v, want: %v", err, sreq.ErrNilBody)
+	}
+}
+
+func TestRequest_ToCurl(t *testing.T) {
+	req := sreq.NewRequest(sreq.MethodPost, "http://httpbin.org/post").
+		SetHeaders(sreq.Headers{
+			"X-Token": "it's a secret",
+		}).
+		SetCookies(&http.Cookie{
+			Name:  "n1",
+			Value: "v1",
+		}).
+		SetJSON(map[string]interface{}{
+			"msg": "hello world",
+		}, true)
+	cmd, err := req.ToCurl()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `curl -X 'POST' 'http://httpbin.org/post'` +
+		` -H 'Content-Type: application/json'` +
+		` -b 'n1=v1'` +
+		` -H 'User-Agent: go-sreq/` + sreq.Version + `'` +
+		` -H 'X-Token: it'\''s a secret'` +
+		` --data '{"msg":"hello world"}` + "\n'"
+	if cmd != want {
+		t.Errorf("Request_ToCurl got: %s, want: %s", cmd, want)
+	}
+
+	cmd, err = sreq.NewRequest(sreq.MethodPost, "http://httpbin.org/post").
+		SetMultipart(sreq.Files{
+			"file": sreq.NewFile("a.txt", strings.NewReader("hello")).SetMIME("text/plain"),
+		}, sreq.Form{
+			"k": "v",
+		}).
+		ToCurl()
+	want = `curl -X 'POST' 'http://httpbin.org/post'` +
+		` -H 'User-Agent: go-sreq/` + sreq.Version + `'` +
+		` -F 'file=@a.txt;type=text/plain' -F 'k=v'`
+	if err != nil || cmd != want {
+		t.Errorf("Request_ToCurl got: %s, want: %s", cmd, want)
+	}
+
+	_, err = sreq.NewRequest(sreq.MethodPost, "http://httpbin.org/post").
+		SetBody(struct{ io.Reader }{strings.NewReader("hello")}).
+		ToCurl()
+	if err != sreq.ErrStreamBody {
+		t.Errorf("Request_ToCurl got error: %v, want: %v", err, sreq.ErrStreamBody)
+	}
+}
+
+func TestRequest_Fingerprint(t *testing.T) {
+	newRequest := func(requestId string, msg string) *sreq.Request {
+		return sreq.NewRequest(sreq.MethodPost, "http://httpbin.org/post").
+			SetQuery(sreq.Params{
+				"k1": "v1",
+				"k2": "v2",
+			}).
+			SetHeaders(sreq.Headers{
+				"X-Request-Id": requestId,
+				"Origin":       "http://httpbin.org",
+			}).
+			SetText(msg)
+	}
+
+	fp := newRequest("1", "hello world").Fingerprint()
+	if got := newRequest("2", "hello world").Fingerprint(); got != fp {
+		t.Errorf("Request_Fingerprint got: %s, want: %s", got, fp)
+	}
+	if got := newRequest("1", "hello sreq").Fingerprint(); got == fp {
+		t.Error("Request_Fingerprint test failed")
+	}
+	if got := sreq.NewRequest("@", "http://httpbin.org/post").Fingerprint(); got != "" {
+		t.Errorf("Request_Fingerprint got: %s, want an empty string", got)
+	}
+}
+
+func TestWithIfMatch(t *testing.T) {
+	const etag = `"v2"`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Match") != etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	resp := client.Put(ts.URL, sreq.WithIfMatch(`"v1"`))
+	if !resp.IsPreconditionFailed() {
+		t.Error("WithIfMatch test failed")
+	}
+
+	resp = client.Put(ts.URL, sreq.WithIfMatch(etag))
+	if resp.IsPreconditionFailed() || resp.EnsureStatus(http.StatusNoContent).Err != nil {
+		t.Error("WithIfMatch test failed")
+	}
+}
+
+func TestWithPriority(t *testing.T) {
+	tests := []struct {
+		urgency     int
+		incremental bool
+		want        string
+	}{
+		{0, false, "u=0"},
+		{3, true, "u=3, i"},
+		{7, false, "u=7"},
+	}
+	for _, test := range tests {
+		req := sreq.NewRequest(sreq.MethodGet, "http://httpbin.org/get").
+			SetPriority(test.urgency, test.incremental)
+		if got := req.RawRequest.Header.Get("Priority"); req.Err != nil || got != test.want {
+			t.Errorf("WithPriority got: %q, want: %q", got, test.want)
+		}
+	}
+
+	for _, urgency := range []int{-1, 8} {
+		req := sreq.NewRequest(sreq.MethodGet, "http://httpbin.org/get")
+		if err := sreq.WithPriority(urgency, false)(req).Err; err == nil {
+			t.Errorf("WithPriority should fail for urgency: %d", urgency)
+		}
+	}
+}
+
+func TestWithCookieString(t *testing.T) {
+	req := sreq.NewRequest(sreq.MethodGet, "http://httpbin.org/cookies").
+		SetCookieString("  n1=v1;; n2=v2 ;  ; n3=\"v3\"; ")
+	cookies := req.RawRequest.Cookies()
+	want := map[string]string{
+		"n1": "v1",
+		"n2": "v2",
+		"n3": "v3",
+	}
+	got := make(map[string]string, len(cookies))
+	for _, c := range cookies {
+		got[c.Name] = c.Value
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WithCookieString got: %v, want: %v", got, want)
+	}
+}
+
+func TestWithRetryHook(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Nonce") != "2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(r.Header.Get("X-Nonce")))
+	}))
+	defer ts.Close()
+
+	var attempts []int
+	client := sreq.New()
+	data, err := client.
+		Get(ts.URL,
+			sreq.WithHeaders(sreq.Headers{
+				"X-Nonce": "0",
+			}),
+			sreq.WithRetry(5, 10*time.Millisecond, sreq.RetryOnStatus(http.StatusUnauthorized)),
+			sreq.WithRetryHook(func(attempt int, req *sreq.Request) {
+				attempts = append(attempts, attempt)
+				req.RawRequest.Header.Set("X-Nonce", strconv.Itoa(attempt))
+			}),
+		).
+		EnsureStatusOk().
+		Text()
+	if err != nil || data != "2" {
+		t.Errorf("WithRetryHook got: %q, want: %q", data, "2")
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(attempts, want) {
+		t.Errorf("WithRetryHook got attempts: %v, want: %v", attempts, want)
+	}
+}
+
+type delayedReader struct {
+	delay time.Duration
+	err   error
+}
+
+func (r *delayedReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	if r.err != nil {
+		return 0, r.err
+	}
+	return copy(p, "hello world"), io.EOF
+}
+
+func TestWithMultipart_ErrorPrecedence(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+	}))
+	defer ts.Close()
+
+	const timeout = 100 * time.Millisecond
+	client := sreq.New()
+	send := func(delay time.Duration, readErr error) error {
+		_, err := client.
+			Post(ts.URL,
+				sreq.WithMultipart(sreq.Files{
+					"file": sreq.NewFile("file.txt", &delayedReader{delay: delay, err: readErr}).SetMIME("text/plain"),
+				}, nil),
+				sreq.WithTimeout(timeout),
+			).
+			Raw()
+		return err
+	}
+
+	// The background error raised right after the timeout wins.
+	err := send(timeout+10*time.Millisecond, errors.New("read failed"))
+	if _, ok := err.(*sreq.RequestError); !ok {
+		t.Errorf("WithMultipart got error: %v, want a *sreq.RequestError", err)
+	}
+
+	// The timeout wins if the background error is caused by the aborted request,
+	// i.e. writing to the closed pipe.
+	err = send(timeout+10*time.Millisecond, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("WithMultipart got error: %v, want: %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestWithTag(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k := range r.Header {
+			if strings.Contains(strings.ToLower(k), "endpoint") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	var endpoints []string
+	client := sreq.New().
+		UseRequestInterceptors(func(req *sreq.Request) error {
+			if endpoint, ok := req.Tag("endpoint"); ok {
+				endpoints = append(endpoints, endpoint)
+			}
+			return nil
+		})
+	err := client.
+		Get(ts.URL, sreq.WithTag("endpoint", "search")).
+		EnsureStatusOk().
+		Error()
+	if err != nil {
+		t.Error(err)
+	}
+
+	client.Get(ts.URL)
+	if want := []string{"search"}; !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("WithTag got: %v, want: %v", endpoints, want)
+	}
+}
+
+func TestRequest_Clone(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(strings.Join(r.Header["X-Token"], ",") + ":" +
+			strings.Join(r.URL.Query()["page"], ",") + ":" + string(b)))
+	}))
+	defer ts.Close()
+
+	base := sreq.NewRequest(sreq.MethodPost, ts.URL).
+		SetHeaders(sreq.Headers{
+			"X-Token": "base",
+		}).
+		SetQuery(sreq.Params{
+			"page": 1,
+		}).
+		SetText("hello world").
+		SetTag("endpoint", "base").
+		SetTimeout(10 * time.Second)
+
+	clone := base.Clone().
+		SetHeaders(sreq.Headers{
+			"X-Token": "clone",
+		}).
+		SetQuery(sreq.Params{
+			"page": 2,
+		}).
+		SetTag("endpoint", "clone")
+
+	if tag, _ := base.Tag("endpoint"); tag != "base" {
+		t.Errorf("Request_Clone got original tag: %q, want: %q", tag, "base")
+	}
+
+	client := sreq.New()
+	for req, want := range map[*sreq.Request]string{
+		base:  "base:1:hello world",
+		clone: "base,clone:1,2:hello world",
+	} {
+		data, err := client.Do(req).Text()
+		if err != nil || data != want {
+			t.Errorf("Request_Clone got: %q, want: %q", data, want)
+		}
+	}
+}
+
+func TestWithAcceptStatus(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	client := sreq.New().SetRetry(3, 10*time.Millisecond, func(resp *sreq.Response) bool {
+		return !resp.IsSuccess()
+	})
+
+	err := client.
+		Get(ts.URL, sreq.WithAcceptStatus(http.StatusNotFound)).
+		EnsureStatusIn(http.StatusOK, http.StatusNotFound).
+		Error()
+	if err != nil || atomic.LoadInt32(&attempts) != 1 {
+		t.Errorf("WithAcceptStatus got attempts: %d, want: %d", attempts, 1)
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+	client.Get(ts.URL)
+	if atomic.LoadInt32(&attempts) != 3 {
+		t.Errorf("WithAcceptStatus got attempts: %d, want: %d", attempts, 3)
+	}
+}
+
+func TestWithMultipartMulti(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var received []string
+		for _, fh := range r.MultipartForm.File["files[]"] {
+			f, _ := fh.Open()
+			b, _ := ioutil.ReadAll(f)
+			f.Close()
+			received = append(received, fh.Filename+"="+string(b))
+		}
+		received = append(received, "k="+r.FormValue("k"))
+		w.Write([]byte(strings.Join(received, ",")))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	data, err := client.
+		Post(ts.URL,
+			sreq.WithMultipartMulti(map[string][]*sreq.File{
+				"files[]": {
+					sreq.NewFile("a.txt", strings.NewReader("hello")),
+					sreq.NewFile("b.txt", strings.NewReader("world")),
+				},
+			}, sreq.Form{
+				"k": "v",
+			}),
+		).
+		EnsureStatusOk().
+		Text()
+	if want := "a.txt=hello,b.txt=world,k=v"; err != nil || data != want {
+		t.Errorf("WithMultipartMulti got: %q, want: %q", data, want)
+	}
+}
+
+func TestWithRawMultipart(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		b, _ := ioutil.ReadAll(file)
+		w.Write([]byte(r.FormValue("key") + " " + string(b)))
+	}))
+	defer ts.Close()
+
+	const body = "--sreq-boundary\r\n" +
+		"Content-Disposition: form-data; name=\"key\"\r\n\r\n" +
+		"value\r\n" +
+		"--sreq-boundary\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"hello.txt\"\r\n" +
+		"Content-Type: text/plain\r\n\r\n" +
+		"hello world\r\n" +
+		"--sreq-boundary--\r\n"
+	data, err := sreq.
+		Post(ts.URL,
+			sreq.WithRawMultipart(strings.NewReader(body), "sreq-boundary"),
+		).
+		EnsureStatusOk().
+		Text()
+	if err != nil || data != "value hello world" {
+		t.Errorf("WithRawMultipart got: %q, want: %q", data, "value hello world")
+	}
+
+	req := sreq.NewRequest(sreq.MethodPost, ts.URL).SetRawMultipart(strings.NewReader(body), "")
+	if req.Err == nil {
+		t.Error("WithRawMultipart test failed")
+	}
+}
+
+func TestWithMultipartProgress(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+	}))
+	defer ts.Close()
+
+	const size = 1 << 20
+	var (
+		calls   int
+		written int64
+	)
+	err := sreq.New().
+		Post(ts.URL,
+			sreq.WithMultipart(sreq.Files{
+				"file": sreq.NewFile("large.bin", bytes.NewReader(make([]byte, size))),
+			}, nil),
+			sreq.WithMultipartProgress(func(n int64) {
+				if n < written {
+					t.Errorf("WithMultipartProgress got decreasing progress: %d < %d", n, written)
+				}
+				calls++
+				written = n
+			}),
+		).
+		EnsureStatusOk().
+		Error()
+	if err != nil || written != size || calls < 2 {
+		t.Errorf("WithMultipartProgress got written: %d in %d calls, want: %d", written, calls, size)
+	}
+}
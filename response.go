@@ -1,28 +1,66 @@
 package sreq
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/text/encoding"
+	"gopkg.in/yaml.v3"
 )
 
 type (
 	// Response wraps the raw HTTP response.
+	// OriginalEncoding is the Content-Encoding of the HTTP response as received, e.g. "gzip",
+	// even if the HTTP response body has been decompressed transparently and the header has been removed.
 	Response struct {
-		RawResponse *http.Response
-		Err         error
-
-		body []byte
+		RawResponse      *http.Response
+		Err              error
+		OriginalEncoding string
+
+		body          []byte
+		streamed      bool
+		trace         *TraceInfo
+		autoCloseBody bool
+		maxBodySize   int64
+		attempt       int
+		raw           bool
+		receivedAt    time.Time
 	}
 
 	// ResponseInterceptor specifies a response interceptor.
 	ResponseInterceptor func(*Response) error
+
+	// ResponseInterceptorCtx specifies a response interceptor with access to the request
+	// and the attempt which produced the response, 0 for the first one and n for the nth retry.
+	ResponseInterceptorCtx func(req *Request, resp *Response, attempt int) error
+
+	// AttemptInterceptor specifies an interceptor called after each attempt of a request, including the retries,
+	// attempt is 0 for the first one and n for the nth retry.
+	AttemptInterceptor func(req *Request, resp *Response, attempt int) error
+
+	// RateLimitInfo records the rate limit of an API, parsed from the HTTP response headers.
+	// Reset is the time when Remaining is reset to Limit, or zero if unknown.
+	RateLimitInfo struct {
+		Limit     int
+		Remaining int
+		Reset     time.Time
+	}
 )
 
 // Raw returns the raw HTTP response.
@@ -30,18 +68,133 @@ func (resp *Response) Raw() (*http.Response, error) {
 	return resp.RawResponse, resp.Err
 }
 
+// Error returns the error of the HTTP response, used to terminate a chain
+// when you only care about whether the HTTP request succeeded.
+func (resp *Response) Error() error {
+	resp.closeBodyOnError()
+	return resp.Err
+}
+
+// closeBodyOnError drains and closes the HTTP response body if resp.Err is set
+// and the client enables SetAutoCloseBodyOnError, so that the connection can be reused.
+func (resp *Response) closeBodyOnError() {
+	if !resp.autoCloseBody || resp.Err == nil || resp.RawResponse == nil ||
+		resp.body != nil || resp.streamed {
+		return
+	}
+
+	const maxDrainBytes = 4 << 10
+	io.CopyN(ioutil.Discard, resp.RawResponse.Body, maxDrainBytes)
+	resp.RawResponse.Body.Close()
+	resp.streamed = true
+}
+
+// Trace returns the timing metrics of the HTTP request.
+// It's nil unless the HTTP request enables trace.
+func (resp *Response) Trace() *TraceInfo {
+	return resp.trace
+}
+
+// TeeTo makes the subsequent read of the HTTP response body also write to w,
+// e.g. a hasher or a progress counter, so that the body needn't be buffered twice.
+// If the HTTP response body has been read already, the buffered data will be written to w immediately.
+func (resp *Response) TeeTo(w io.Writer) *Response {
+	if resp.Err != nil {
+		return resp
+	}
+
+	if resp.body != nil {
+		_, resp.Err = w.Write(resp.body)
+		return resp
+	}
+
+	resp.RawResponse.Body = &teeReadCloser{
+		Reader: io.TeeReader(resp.RawResponse.Body, w),
+		Closer: resp.RawResponse.Body,
+	}
+	return resp
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Stream returns the live HTTP response body without buffering it,
+// the caller is responsible for closing it.
+// Notes: Stream makes the HTTP response body unavailable for the other decode methods,
+// unless it has been read before.
+func (resp *Response) Stream() (io.ReadCloser, error) {
+	resp.closeBodyOnError()
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+
+	if resp.body != nil {
+		return ioutil.NopCloser(bytes.NewReader(resp.body)), nil
+	}
+
+	if resp.streamed {
+		return nil, ErrResponseBodyStreamed
+	}
+
+	resp.streamed = true
+	return resp.RawResponse.Body, nil
+}
+
 // Content decodes the HTTP response body to bytes.
 func (resp *Response) Content() ([]byte, error) {
+	resp.closeBodyOnError()
 	if resp.Err != nil || resp.body != nil {
 		return resp.body, resp.Err
 	}
+	if resp.streamed {
+		return nil, ErrResponseBodyStreamed
+	}
 	defer resp.RawResponse.Body.Close()
 
+	var body io.Reader = resp.RawResponse.Body
+	if resp.maxBodySize > 0 {
+		body = &bodyLimiter{
+			LimitedReader: io.LimitedReader{
+				R: body,
+				N: resp.maxBodySize + 1,
+			},
+		}
+	}
+
 	var err error
-	resp.body, err = ioutil.ReadAll(resp.RawResponse.Body)
+	resp.body, err = ioutil.ReadAll(body)
+	if err == ErrResponseBodyTooLarge {
+		resp.body = nil
+		resp.Err = err
+	}
 	return resp.body, err
 }
 
+// Cache reads and buffers the HTTP response body eagerly, then closes it to release the connection,
+// so that the subsequent decode methods, e.g. Text, JSON and XML, are guaranteed to reuse the buffered data.
+// If the read fails, resp.Err will be set.
+func (resp *Response) Cache() *Response {
+	if _, err := resp.Content(); err != nil {
+		resp.Err = err
+	}
+	return resp
+}
+
+// bodyLimiter reads at most N-1 bytes, the extra one is used to detect whether the limit is exceeded.
+type bodyLimiter struct {
+	io.LimitedReader
+}
+
+func (bl *bodyLimiter) Read(p []byte) (int, error) {
+	n, err := bl.LimitedReader.Read(p)
+	if bl.N <= 0 {
+		return n, ErrResponseBodyTooLarge
+	}
+	return n, err
+}
+
 // Text decodes the HTTP response body and returns the text representation of its raw data
 // given an optional charset encoding.
 func (resp *Response) Text(e ...encoding.Encoding) (string, error) {
@@ -56,12 +209,113 @@ func (resp *Response) Text(e ...encoding.Encoding) (string, error) {
 
 // JSON decodes the HTTP response body and unmarshals its JSON-encoded data into v.
 func (resp *Response) JSON(v interface{}) error {
+	b, err := resp.Content()
+	if err != nil {
+		return err
+	}
+
+	return JSONUnmarshal(b, v)
+}
+
+// JSONDecoder returns a JSON decoder reading from the HTTP response body, and a cleanup func
+// that closes the HTTP response body, which should be called once the decoding is done.
+// It's useful for stream-decoding with custom settings, e.g. UseNumber or DisallowUnknownFields,
+// or decoding multiple top-level values.
+// Notes: JSONDecoder makes the HTTP response body unavailable for the other decode methods,
+// unless it has been read before.
+func (resp *Response) JSONDecoder() (*json.Decoder, func(), error) {
+	rc, err := resp.Stream()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return json.NewDecoder(rc), func() { rc.Close() }, nil
+}
+
+// MustBytes is like Content, but panics if there is an error.
+// It's intended for scripts and tests where a failure should abort.
+func (resp *Response) MustBytes() []byte {
+	b, err := resp.Content()
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// MustText is like Text, but panics if there is an error.
+// It's intended for scripts and tests where a failure should abort.
+func (resp *Response) MustText(e ...encoding.Encoding) string {
+	text, err := resp.Text(e...)
+	if err != nil {
+		panic(err)
+	}
+
+	return text
+}
+
+// MustJSON is like JSON, but panics if there is an error.
+// It's intended for scripts and tests where a failure should abort.
+func (resp *Response) MustJSON(v interface{}) {
+	if err := resp.JSON(v); err != nil {
+		panic(err)
+	}
+}
+
+// JSON5 is like JSON, but tolerates the comments and trailing commas allowed by JSON5,
+// which are common in config APIs. Other JSON5 extensions, such as unquoted keys, aren't supported.
+func (resp *Response) JSON5(v interface{}) error {
+	b, err := resp.Content()
+	if err != nil {
+		return err
+	}
+
+	return JSONUnmarshal(relaxJSON(b), v)
+}
+
+// H decodes the HTTP response body and unmarshals its JSON-encoded data into an H instance.
+func (resp *Response) H() (H, error) {
+	h := make(H)
+	return h, resp.JSON(&h)
+}
+
+// JSONMap decodes the HTTP response body and unmarshals its JSON-encoded data,
+// which should be a flat object with string values, into a map[string]string instance.
+func (resp *Response) JSONMap() (map[string]string, error) {
+	m := make(map[string]string)
+	return m, resp.JSON(&m)
+}
+
+// JSONAnyMap decodes the HTTP response body and unmarshals its JSON-encoded data,
+// which should be an object, into a map[string]interface{} instance.
+func (resp *Response) JSONAnyMap() (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	return m, resp.JSON(&m)
+}
+
+// XML decodes the HTTP response body and unmarshals its XML-encoded data into v.
+func (resp *Response) XML(v interface{}) error {
+	return resp.XMLWith(v, nil)
+}
+
+// XMLWith is like XML, but calls configure, if non-nil, to customize the decoder before decoding,
+// e.g. setting CharsetReader for non-UTF-8 documents or disabling Strict mode.
+func (resp *Response) XMLWith(v interface{}, configure func(*xml.Decoder)) error {
+	resp.closeBodyOnError()
 	if resp.Err != nil {
 		return resp.Err
 	}
 
-	if resp.body != nil {
-		return json.Unmarshal(resp.body, v)
+	if resp.body != nil || resp.maxBodySize > 0 {
+		b, err := resp.Content()
+		if err != nil {
+			return err
+		}
+		return newXMLDecoder(bytes.NewReader(b), configure).Decode(v)
+	}
+
+	if resp.streamed {
+		return ErrResponseBodyStreamed
 	}
 
 	buf := acquireBuffer()
@@ -72,23 +326,34 @@ func (resp *Response) JSON(v interface{}) error {
 		releaseBuffer(buf)
 	}()
 
-	return json.NewDecoder(tee).Decode(v)
+	return newXMLDecoder(tee, configure).Decode(v)
 }
 
-// H decodes the HTTP response body and unmarshals its JSON-encoded data into an H instance.
-func (resp *Response) H() (H, error) {
-	h := make(H)
-	return h, resp.JSON(&h)
+func newXMLDecoder(r io.Reader, configure func(*xml.Decoder)) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	if configure != nil {
+		configure(decoder)
+	}
+	return decoder
 }
 
-// XML decodes the HTTP response body and unmarshals its XML-encoded data into v.
-func (resp *Response) XML(v interface{}) error {
+// YAML decodes the HTTP response body and unmarshals its YAML-encoded data into v.
+func (resp *Response) YAML(v interface{}) error {
+	resp.closeBodyOnError()
 	if resp.Err != nil {
 		return resp.Err
 	}
 
-	if resp.body != nil {
-		return xml.Unmarshal(resp.body, v)
+	if resp.body != nil || resp.maxBodySize > 0 {
+		b, err := resp.Content()
+		if err != nil {
+			return err
+		}
+		return yaml.Unmarshal(b, v)
+	}
+
+	if resp.streamed {
+		return ErrResponseBodyStreamed
 	}
 
 	buf := acquireBuffer()
@@ -99,7 +364,134 @@ func (resp *Response) XML(v interface{}) error {
 		releaseBuffer(buf)
 	}()
 
-	return xml.NewDecoder(tee).Decode(v)
+	return yaml.NewDecoder(tee).Decode(v)
+}
+
+// Msgpack decodes the HTTP response body and unmarshals its MessagePack-encoded data into v.
+func (resp *Response) Msgpack(v interface{}) error {
+	b, err := resp.Content()
+	if err != nil {
+		return err
+	}
+
+	return msgpackUnmarshal(b, v)
+}
+
+// DecodeByStatus decodes the HTTP response body into success if the HTTP response's status code is 2xx,
+// otherwise into failure and returns a *StatusError carrying it.
+// The body is decoded as XML if IsXML reports true, or as JSON otherwise.
+// A nil success or failure skips decoding, the body is still available for the other decode methods.
+func (resp *Response) DecodeByStatus(success interface{}, failure interface{}) error {
+	if _, err := resp.Content(); err != nil {
+		return err
+	}
+
+	if resp.IsSuccess() {
+		if success == nil {
+			return nil
+		}
+		return resp.decode(success)
+	}
+
+	statusErr := &StatusError{
+		StatusCode: resp.RawResponse.StatusCode,
+	}
+	if failure != nil {
+		if statusErr.Err = resp.decode(failure); statusErr.Err == nil {
+			statusErr.Failure = failure
+		}
+	}
+	return statusErr
+}
+
+func (resp *Response) decode(v interface{}) error {
+	if resp.IsXML() {
+		return resp.XML(v)
+	}
+	return resp.JSON(v)
+}
+
+// IsJSON reports whether the HTTP response body is JSON-encoded.
+// It checks the Content-Type header first, and sniffs the leading non-whitespace byte of the HTTP response body
+// for '{' or '[' if the Content-Type header is absent or not specific.
+func (resp *Response) IsJSON() bool {
+	return resp.isFormat(func(mediaType string) bool {
+		return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	}, '{', '[')
+}
+
+// IsXML reports whether the HTTP response body is XML-encoded.
+// It checks the Content-Type header first, and sniffs the leading non-whitespace byte of the HTTP response body
+// for '<' if the Content-Type header is absent or not specific.
+func (resp *Response) IsXML() bool {
+	return resp.isFormat(func(mediaType string) bool {
+		return mediaType == "application/xml" || mediaType == "text/xml" ||
+			strings.HasSuffix(mediaType, "+xml")
+	}, '<')
+}
+
+func (resp *Response) isFormat(match func(mediaType string) bool, leading ...byte) bool {
+	if resp.Err != nil || resp.RawResponse == nil {
+		return false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.RawResponse.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "text/plain", "application/octet-stream":
+	default:
+		return match(mediaType)
+	}
+
+	b := resp.peek()
+	b = bytes.TrimLeft(b, " \t\r\n")
+	if len(b) == 0 {
+		return false
+	}
+	return bytes.IndexByte(leading, b[0]) != -1
+}
+
+// peek returns the leading bytes of the HTTP response body without consuming it.
+func (resp *Response) peek() []byte {
+	const (
+		sniffLen = 512
+	)
+
+	if resp.body != nil {
+		return resp.body
+	}
+
+	if resp.streamed || resp.RawResponse.Body == nil {
+		return nil
+	}
+
+	br, ok := resp.RawResponse.Body.(*peekReadCloser)
+	if !ok {
+		br = &peekReadCloser{
+			Reader: bufio.NewReaderSize(resp.RawResponse.Body, sniffLen),
+			Closer: resp.RawResponse.Body,
+		}
+		resp.RawResponse.Body = br
+	}
+
+	b, _ := br.Peek(sniffLen)
+	return b
+}
+
+type peekReadCloser struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// Trailers returns the HTTP response trailers.
+// Since trailers are only available after the HTTP response body is fully read,
+// Trailers reads the HTTP response body and makes it reused first.
+func (resp *Response) Trailers() (http.Header, error) {
+	_, err := resp.Content()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.RawResponse.Trailer, nil
 }
 
 // Cookies returns the HTTP response cookies.
@@ -132,6 +524,157 @@ func (resp *Response) Cookie(name string) (*http.Cookie, error) {
 	return nil, ErrResponseNamedCookieNotPresent
 }
 
+// SetCookie returns the named cookie parsed from the HTTP response's Set-Cookie headers,
+// with all of its attributes, such as Expires, MaxAge, HttpOnly, Secure and SameSite, preserved.
+// If the named cookie is set more than once, the last one wins as a user agent would apply.
+func (resp *Response) SetCookie(name string) (*http.Cookie, error) {
+	cookies, err := resp.Cookies()
+	if err != nil {
+		return nil, err
+	}
+
+	var cookie *http.Cookie
+	for _, c := range cookies {
+		if c.Name == name {
+			cookie = c
+		}
+	}
+
+	if cookie == nil {
+		return nil, ErrResponseNamedCookieNotPresent
+	}
+	return cookie, nil
+}
+
+// Date returns the time parsed from the HTTP response's Date header,
+// ok reports whether the header is present and valid.
+func (resp *Response) Date() (t time.Time, ok bool) {
+	if resp.Err != nil {
+		return
+	}
+
+	t, err := http.ParseTime(resp.RawResponse.Header.Get("Date"))
+	return t, err == nil
+}
+
+// ClockSkew returns the difference between the server's time, i.e. the HTTP response's Date header,
+// and the local time when the HTTP response was received, it's positive if the server's clock is ahead.
+// Notes: the Date header has a resolution of one second.
+func (resp *Response) ClockSkew() (time.Duration, bool) {
+	t, ok := resp.Date()
+	if !ok {
+		return 0, false
+	}
+
+	receivedAt := resp.receivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+	return t.Sub(receivedAt), true
+}
+
+// rateLimitPrefixes are the prefixes of the rate limit headers in use, e.g. X-RateLimit-Limit used by GitHub,
+// and RateLimit-Limit proposed by the IETF draft.
+var rateLimitPrefixes = []string{"X-Ratelimit-", "Ratelimit-"}
+
+// epochThreshold distinguishes a reset of epoch seconds from the one of delta seconds,
+// a delta won't be such long, i.e. 30 years.
+const epochThreshold = 1e9
+
+// RateLimit returns the rate limit parsed from the HTTP response's X-RateLimit-Limit, X-RateLimit-Remaining
+// and X-RateLimit-Reset headers, or their RateLimit-* variants.
+// The reset can be either epoch seconds, e.g. used by GitHub, or delta seconds relative to the Date header.
+// If the headers are absent, ErrNoRateLimit will be returned.
+func (resp *Response) RateLimit() (*RateLimitInfo, error) {
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+
+	h := resp.RawResponse.Header
+	for _, prefix := range rateLimitPrefixes {
+		limit, remaining := h.Get(prefix+"Limit"), h.Get(prefix+"Remaining")
+		if limit == "" && remaining == "" {
+			continue
+		}
+
+		info := new(RateLimitInfo)
+		var err error
+		if limit != "" {
+			if info.Limit, err = strconv.Atoi(strings.TrimSpace(limit)); err != nil {
+				return nil, err
+			}
+		}
+		if remaining != "" {
+			if info.Remaining, err = strconv.Atoi(strings.TrimSpace(remaining)); err != nil {
+				return nil, err
+			}
+		}
+		if reset := h.Get(prefix + "Reset"); reset != "" {
+			seconds, err := strconv.ParseInt(strings.TrimSpace(reset), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			if seconds >= epochThreshold {
+				info.Reset = time.Unix(seconds, 0)
+			} else {
+				base, ok := resp.Date()
+				if !ok {
+					base = time.Now()
+				}
+				info.Reset = base.Add(time.Duration(seconds) * time.Second)
+			}
+		}
+		return info, nil
+	}
+
+	return nil, ErrNoRateLimit
+}
+
+// StatusCode returns the HTTP response's status code.
+func (resp *Response) StatusCode() (int, error) {
+	if resp.Err != nil {
+		return 0, resp.Err
+	}
+
+	return resp.RawResponse.StatusCode, nil
+}
+
+// IsSuccess reports whether the HTTP response's status code is 2xx.
+func (resp *Response) IsSuccess() bool {
+	return resp.Err == nil && resp.RawResponse != nil && resp.RawResponse.StatusCode/100 == 2
+}
+
+// IsClientError reports whether the HTTP response's status code is 4xx.
+func (resp *Response) IsClientError() bool {
+	return resp.Err == nil && resp.RawResponse != nil && resp.RawResponse.StatusCode/100 == 4
+}
+
+// IsServerError reports whether the HTTP response's status code is 5xx.
+func (resp *Response) IsServerError() bool {
+	return resp.Err == nil && resp.RawResponse != nil && resp.RawResponse.StatusCode/100 == 5
+}
+
+// IsPreconditionFailed reports whether the HTTP response's status code is 412,
+// i.e. a conditional request, such as one with If-Match header, failed.
+func (resp *Response) IsPreconditionFailed() bool {
+	return resp.Err == nil && resp.RawResponse != nil && resp.RawResponse.StatusCode == http.StatusPreconditionFailed
+}
+
+// IsChunked reports whether the HTTP response used chunked transfer encoding,
+// in which case its ContentLength is unknown, i.e. -1.
+func (resp *Response) IsChunked() bool {
+	if resp.Err != nil || resp.RawResponse == nil {
+		return false
+	}
+
+	for _, te := range resp.RawResponse.TransferEncoding {
+		if strings.EqualFold(te, "chunked") {
+			return true
+		}
+	}
+	return false
+}
+
 // EnsureStatusOk ensures the HTTP response's status code must be 200.
 func (resp *Response) EnsureStatusOk() *Response {
 	return resp.EnsureStatus(http.StatusOK)
@@ -161,15 +704,111 @@ func (resp *Response) EnsureStatus(code int) *Response {
 	return resp
 }
 
+// EnsureStatusIn ensures the HTTP response's status code must be one of the codes parameter.
+func (resp *Response) EnsureStatusIn(codes ...int) *Response {
+	if resp.Err != nil {
+		return resp
+	}
+
+	for _, code := range codes {
+		if resp.RawResponse.StatusCode == code {
+			return resp
+		}
+	}
+
+	resp.Err = fmt.Errorf("sreq: bad status: %d, want one of: %v", resp.RawResponse.StatusCode, codes)
+	return resp
+}
+
 // Save saves the HTTP response into a file.
 // Notes: Save won't make the HTTP response body reused.
 func (resp *Response) Save(filename string, perm os.FileMode) error {
+	return resp.SaveWithProgress(filename, perm, nil)
+}
+
+// SaveAndVerify saves the HTTP response into a file and verifies its checksum in one pass,
+// algo supports "md5", "sha1" and "sha256", expectedHex is the hex-encoded expected digest.
+// If the checksum doesn't match, the file will be removed and ErrChecksumMismatch will be returned.
+// Notes: SaveAndVerify won't make the HTTP response body reused.
+func (resp *Response) SaveAndVerify(filename string, perm os.FileMode, algo string, expectedHex string) error {
+	resp.closeBodyOnError()
+	if resp.Err != nil {
+		return resp.Err
+	}
+
+	var h hash.Hash
+	switch strings.ToLower(algo) {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return fmt.Errorf("sreq: unsupported hash algorithm %q", algo)
+	}
+
+	err := resp.TeeTo(h).Save(filename, perm)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), expectedHex) {
+		os.Remove(filename)
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// SaveToWriter saves the HTTP response into w and returns the number of bytes written.
+// Notes: SaveToWriter won't make the HTTP response body reused.
+func (resp *Response) SaveToWriter(w io.Writer) (int64, error) {
+	resp.closeBodyOnError()
+	if resp.Err != nil {
+		return 0, resp.Err
+	}
+
+	if resp.body != nil {
+		n, err := w.Write(resp.body)
+		return int64(n), err
+	}
+
+	if resp.streamed {
+		return 0, ErrResponseBodyStreamed
+	}
+
+	defer resp.RawResponse.Body.Close()
+	return io.Copy(w, resp.RawResponse.Body)
+}
+
+// SaveWithProgress saves the HTTP response into a file and reports the progress to cb,
+// written is the number of bytes written so far and total is the HTTP response's
+// Content-Length, -1 if unknown. cb is called whenever a chunk is written
+// and a final time with the complete count after the HTTP response body has been saved.
+// Notes: SaveWithProgress won't make the HTTP response body reused.
+func (resp *Response) SaveWithProgress(filename string, perm os.FileMode, cb func(written, total int64)) error {
+	resp.closeBodyOnError()
 	if resp.Err != nil {
 		return resp.Err
 	}
 
+	if cb == nil {
+		cb = func(_, _ int64) {}
+	}
+	total := resp.RawResponse.ContentLength
+
 	if resp.body != nil {
-		return ioutil.WriteFile(filename, resp.body, perm)
+		err := ioutil.WriteFile(filename, resp.body, perm)
+		if err != nil {
+			return err
+		}
+
+		cb(int64(len(resp.body)), total)
+		return nil
+	}
+
+	if resp.streamed {
+		return ErrResponseBodyStreamed
 	}
 
 	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
@@ -179,8 +818,34 @@ func (resp *Response) Save(filename string, perm os.FileMode) error {
 	defer file.Close()
 	defer resp.RawResponse.Body.Close()
 
-	_, err = io.Copy(file, resp.RawResponse.Body)
-	return err
+	pr := &progressReader{
+		r:     resp.RawResponse.Body,
+		total: total,
+		cb:    cb,
+	}
+	_, err = io.Copy(file, pr)
+	if err != nil {
+		return err
+	}
+
+	cb(pr.written, total)
+	return nil
+}
+
+type progressReader struct {
+	r       io.Reader
+	written int64
+	total   int64
+	cb      func(written, total int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.written += int64(n)
+		pr.cb(pr.written, pr.total)
+	}
+	return n, err
 }
 
 // Verbose makes the HTTP request and its response more talkative.
@@ -192,7 +857,8 @@ func (resp *Response) Verbose(w io.Writer) error {
 	}
 
 	const (
-		streamBodyTip = "if you see this message it means the HTTP request body is a stream and cannot be read twice"
+		streamBodyTip           = "if you see this message it means the HTTP request body is a stream and cannot be read twice"
+		streamedResponseBodyTip = "if you see this message it means the HTTP response body has been streamed"
 	)
 
 	rawRequest := resp.RawResponse.Request
@@ -241,6 +907,11 @@ handleResponse:
 		return nil
 	}
 
+	if resp.streamed {
+		fmt.Fprintf(w, "* %s\r\n", streamedResponseBodyTip)
+		return nil
+	}
+
 	defer rawResponse.Body.Close()
 	_, err := io.Copy(w, rawResponse.Body)
 	if err != nil {
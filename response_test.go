@@ -1,15 +1,26 @@
 package sreq_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/winterssy/sreq"
+	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
@@ -38,6 +49,22 @@ func TestResponse_Resolve(t *testing.T) {
 	}
 }
 
+func TestResponse_Error(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	if err := client.Get(ts.URL).EnsureStatusOk().Error(); err != nil {
+		t.Error(err)
+	}
+
+	if err := client.Get(ts.URL).EnsureStatus(http.StatusForbidden).Error(); err == nil {
+		t.Error("Response_Error test failed")
+	}
+}
+
 func TestResponse_Text(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var _w io.Writer
@@ -94,6 +121,172 @@ func TestResponse_JSON(t *testing.T) {
 	}
 }
 
+func TestResponse_JSONDecoder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"n":1}` + "\n" + `{"n":2}` + "\n"))
+	}))
+	defer ts.Close()
+
+	resp := sreq.Get(ts.URL).EnsureStatusOk()
+	decoder, cleanup, err := resp.JSONDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	decoder.UseNumber()
+	var got []json.Number
+	for decoder.More() {
+		var v struct {
+			N json.Number `json:"n"`
+		}
+		if err = decoder.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v.N)
+	}
+	if len(got) != 2 || got[0] != "1" || got[1] != "2" {
+		t.Errorf("Response_JSONDecoder got: %v, want: [1 2]", got)
+	}
+
+	if _, _, err = resp.JSONDecoder(); err != sreq.ErrResponseBodyStreamed {
+		t.Error("Response_JSONDecoder test failed")
+	}
+
+	_, _, err = sreq.Get(ts.URL).EnsureStatus(http.StatusForbidden).JSONDecoder()
+	if err == nil {
+		t.Error("Response_JSONDecoder test failed")
+	}
+}
+
+func TestResponse_DecodeByStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/xml":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte("<result><name>sreq</name></result>"))
+		case "/bad":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":40001,"message":"invalid name"}`))
+		case "/malformed":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("bad request"))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name":"sreq"}`))
+		}
+	}))
+	defer ts.Close()
+
+	type (
+		result struct {
+			Name string `json:"name" xml:"name"`
+		}
+
+		apiError struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+	)
+
+	for _, path := range []string{"/json", "/xml"} {
+		var (
+			success result
+			failure apiError
+		)
+		resp := sreq.Get(ts.URL + path)
+		if err := resp.DecodeByStatus(&success, &failure); err != nil || success.Name != "sreq" {
+			t.Errorf("Response_DecodeByStatus got: %+v, error: %v, want: %q", success, err, "sreq")
+		}
+		if data, err := resp.Text(); err != nil || data == "" {
+			t.Error("Response_DecodeByStatus test failed")
+		}
+	}
+
+	var (
+		success result
+		failure apiError
+	)
+	err := sreq.Get(ts.URL+"/bad").DecodeByStatus(&success, &failure)
+	statusErr, ok := err.(*sreq.StatusError)
+	if !ok || statusErr.StatusCode != http.StatusBadRequest || statusErr.Failure != &failure ||
+		failure.Code != 40001 || failure.Message != "invalid name" || success.Name != "" {
+		t.Errorf("Response_DecodeByStatus got: %v, failure: %+v", err, failure)
+	}
+
+	err = sreq.Get(ts.URL+"/malformed").DecodeByStatus(&success, &failure)
+	statusErr, ok = err.(*sreq.StatusError)
+	if !ok || statusErr.StatusCode != http.StatusBadRequest || statusErr.Failure != nil || statusErr.Err == nil ||
+		statusErr.Unwrap() != statusErr.Err {
+		t.Errorf("Response_DecodeByStatus got: %v, want a decode error", err)
+	}
+}
+
+func TestResponse_JSON5(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+	// the name of the app
+	"name": "sreq // not a comment",
+	/* supported versions, */
+	"versions": [
+		"1.12",
+		"1.13", // latest
+	],
+	"escaped": "\\\"/*,]",
+}`))
+	}))
+	defer ts.Close()
+
+	type config struct {
+		Name     string   `json:"name"`
+		Versions []string `json:"versions"`
+		Escaped  string   `json:"escaped"`
+	}
+
+	resp := sreq.New().Get(ts.URL)
+	if err := resp.JSON(new(config)); err == nil {
+		t.Error("Response_JSON5 test failed")
+	}
+
+	var data config
+	want := config{
+		Name:     "sreq // not a comment",
+		Versions: []string{"1.12", "1.13"},
+		Escaped:  `\"/*,]`,
+	}
+	if err := resp.JSON5(&data); err != nil || !reflect.DeepEqual(data, want) {
+		t.Errorf("Response_JSON5 got: %+v, want: %+v, error: %v", data, want, err)
+	}
+}
+
+func TestResponse_JSONMap(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"k1":"v1","k2":"v2"}`))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	resp := client.Get(ts.URL).EnsureStatusOk()
+	m, err := resp.JSONMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"k1": "v1", "k2": "v2"}; !reflect.DeepEqual(m, want) {
+		t.Errorf("Response_JSONMap got: %v, want: %v", m, want)
+	}
+
+	anyMap, err := resp.JSONAnyMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"k1": "v1", "k2": "v2"}; !reflect.DeepEqual(anyMap, want) {
+		t.Errorf("Response_JSONAnyMap got: %v, want: %v", anyMap, want)
+	}
+}
+
 func TestResponse_H(t *testing.T) {
 	client := sreq.New()
 	h, err := client.
@@ -170,6 +363,74 @@ func TestResponse_XML(t *testing.T) {
 	}
 }
 
+func TestResponse_XMLWith(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml; charset=iso-8859-1")
+		w.Write([]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><plant><name>Caf\xe9</name></plant>"))
+	}))
+	defer ts.Close()
+
+	type plant struct {
+		XMLName xml.Name `xml:"plant"`
+		Name    string   `xml:"name"`
+	}
+
+	client := sreq.New()
+	resp := client.Get(ts.URL)
+
+	var data plant
+	if err := resp.XML(&data); err == nil {
+		t.Error("Response_XMLWith test failed")
+	}
+
+	err := resp.XMLWith(&data, func(decoder *xml.Decoder) {
+		decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+			if !strings.EqualFold(label, "ISO-8859-1") {
+				return nil, fmt.Errorf("unsupported charset: %s", label)
+			}
+			return charmap.ISO8859_1.NewDecoder().Reader(input), nil
+		}
+	})
+	if err != nil || data.Name != "Café" {
+		t.Errorf("Response_XMLWith got: %q, want: %q", data.Name, "Café")
+	}
+}
+
+func TestResponse_Trailers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte("hello world"))
+		w.(http.Flusher).Flush()
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	resp := client.
+		Get(ts.URL).
+		EnsureStatusOk()
+	trailers, err := resp.Trailers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trailers.Get("Grpc-Status") != "0" {
+		t.Error("Response_Trailers test failed")
+	}
+
+	data, err := resp.Text()
+	if err != nil || data != "hello world" {
+		t.Error("Response_ReuseBody test failed")
+	}
+
+	_, err = client.
+		Get(ts.URL).
+		EnsureStatus(http.StatusForbidden).
+		Trailers()
+	if err == nil {
+		t.Error("Response_Trailers test failed")
+	}
+}
+
 func TestResponse_Cookie(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.SetCookie(w, &http.Cookie{
@@ -198,6 +459,47 @@ func TestResponse_Cookie(t *testing.T) {
 	}
 }
 
+func TestResponse_SetCookie(t *testing.T) {
+	expires := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{
+			Name:  "sid",
+			Value: "stale",
+		})
+		http.SetCookie(w, &http.Cookie{
+			Name:     "sid",
+			Value:    "10086",
+			Path:     "/",
+			Expires:  expires,
+			MaxAge:   3600,
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	resp := client.
+		Get(ts.URL).
+		EnsureStatusOk()
+
+	cookie, err := resp.SetCookie("sid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookie.Value != "10086" || cookie.Path != "/" || !cookie.Expires.Equal(expires) ||
+		cookie.MaxAge != 3600 || !cookie.Secure || !cookie.HttpOnly ||
+		cookie.SameSite != http.SameSiteStrictMode {
+		t.Errorf("Response_SetCookie got: %+v", cookie)
+	}
+
+	_, err = resp.SetCookie("uid")
+	if err != sreq.ErrResponseNamedCookieNotPresent {
+		t.Error("Response_SetCookie test failed")
+	}
+}
+
 func TestResponse_EnsureStatus(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -364,3 +666,684 @@ func TestResponse_ReuseBody(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestResponse_OriginalEncoding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("gzip") == "" {
+			w.Write([]byte("hello world"))
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte("hello world"))
+		zw.Close()
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		opts []sreq.RequestOption
+		want string
+	}{
+		{
+			opts: []sreq.RequestOption{sreq.WithQuery(sreq.Params{"gzip": 1})},
+			want: "gzip",
+		},
+		{
+			opts: []sreq.RequestOption{
+				sreq.WithQuery(sreq.Params{"gzip": 1}),
+				sreq.WithHeaders(sreq.Headers{"Accept-Encoding": "gzip"}),
+			},
+			want: "gzip",
+		},
+		{
+			want: "",
+		},
+	}
+	for _, test := range tests {
+		resp := sreq.Get(ts.URL, test.opts...).EnsureStatusOk()
+		data, err := resp.Text()
+		if err != nil || data != "hello world" || resp.OriginalEncoding != test.want {
+			t.Errorf("Response_OriginalEncoding got: %q, data: %q, want: %q", resp.OriginalEncoding, data, test.want)
+		}
+	}
+}
+
+func TestResponse_Cache(t *testing.T) {
+	const body = `{"msg":"hello world"}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	resp := sreq.Get(ts.URL).EnsureStatusOk().Cache()
+	if _, err := resp.RawResponse.Body.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Errorf("Response_Cache got read error: %v, want the body closed", err)
+	}
+
+	text, err := resp.Text()
+	if err != nil || text != body {
+		t.Errorf("Response_Cache got text: %q, want: %q", text, body)
+	}
+
+	var v struct {
+		Msg string `json:"msg"`
+	}
+	if err = resp.JSON(&v); err != nil || v.Msg != "hello world" {
+		t.Errorf("Response_Cache got JSON: %v, want: %q", v, "hello world")
+	}
+
+	m, err := resp.JSONMap()
+	if err != nil || m["msg"] != "hello world" {
+		t.Errorf("Response_Cache got JSONMap: %v, want: %q", m, "hello world")
+	}
+
+	err = sreq.Get(ts.URL).EnsureStatus(http.StatusForbidden).Cache().Error()
+	if err == nil {
+		t.Error("Response_Cache test failed")
+	}
+}
+
+func TestResponse_Stream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	resp := client.Get(ts.URL).EnsureStatusOk()
+	rc, err := resp.Stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(data) != "hello world" {
+		t.Errorf("Response_Stream got: %q, want: %q", data, "hello world")
+	}
+
+	if _, err = resp.Stream(); err != sreq.ErrResponseBodyStreamed {
+		t.Error("Response_Stream test failed")
+	}
+	if _, err = resp.Text(); err != sreq.ErrResponseBodyStreamed {
+		t.Error("Response_Stream test failed")
+	}
+	if err = resp.JSON(new(sreq.H)); err != sreq.ErrResponseBodyStreamed {
+		t.Error("Response_Stream test failed")
+	}
+
+	_, err = client.
+		Get(ts.URL).
+		EnsureStatus(http.StatusForbidden).
+		Stream()
+	if err == nil {
+		t.Error("Response_Stream test failed")
+	}
+}
+
+func TestResponse_SaveAndVerify(t *testing.T) {
+	const (
+		payload = "hello world"
+		digest  = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(payload))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	err := client.
+		Get(ts.URL).
+		EnsureStatusOk().
+		SaveAndVerify(testFileName, 0664, "sha256", digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(testFileName); string(data) != payload {
+		t.Error("Response_SaveAndVerify test failed")
+	}
+
+	err = client.
+		Get(ts.URL).
+		EnsureStatusOk().
+		SaveAndVerify(testFileName, 0664, "sha256", strings.Repeat("0", 64))
+	if err != sreq.ErrChecksumMismatch {
+		t.Error("Response_SaveAndVerify test failed")
+	}
+	if _, err = os.Stat(testFileName); !os.IsNotExist(err) {
+		t.Error("Response_SaveAndVerify should remove the file on mismatch")
+	}
+
+	err = client.
+		Get(ts.URL).
+		SaveAndVerify(testFileName, 0664, "crc32", digest)
+	if err == nil {
+		t.Error("Response_SaveAndVerify test failed")
+	}
+}
+
+func TestResponse_SaveToWriter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	var buf bytes.Buffer
+	n, err := client.
+		Get(ts.URL).
+		EnsureStatusOk().
+		SaveToWriter(&buf)
+	if err != nil || n != 11 || buf.String() != "hello world" {
+		t.Errorf("Response_SaveToWriter got: %q, want: %q", buf.String(), "hello world")
+	}
+
+	resp := client.Get(ts.URL)
+	if _, err = resp.Content(); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	n, err = resp.SaveToWriter(&buf)
+	if err != nil || n != 11 || buf.String() != "hello world" {
+		t.Errorf("Response_SaveToWriter got: %q, want: %q", buf.String(), "hello world")
+	}
+
+	_, err = client.
+		Get(ts.URL).
+		EnsureStatus(http.StatusForbidden).
+		SaveToWriter(&buf)
+	if err == nil {
+		t.Error("Response_SaveToWriter test failed")
+	}
+}
+
+func TestResponse_SaveWithProgress(t *testing.T) {
+	const (
+		size = 1 << 20
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		w.Write(bytes.Repeat([]byte("a"), size))
+	}))
+	defer ts.Close()
+
+	var (
+		calls     int
+		lastWrite int64
+		lastTotal int64
+	)
+	cb := func(written, total int64) {
+		calls++
+		lastWrite, lastTotal = written, total
+	}
+
+	client := sreq.New()
+	err := client.
+		Get(ts.URL).
+		EnsureStatusOk().
+		SaveWithProgress(testFileName, 0664, cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls < 2 || lastWrite != size || lastTotal != size {
+		t.Errorf("Response_SaveWithProgress got: (%d, %d), want: (%d, %d)", lastWrite, lastTotal, size, size)
+	}
+
+	err = client.
+		Get(ts.URL).
+		EnsureStatus(http.StatusForbidden).
+		SaveWithProgress(testFileName, 0664, cb)
+	if err == nil {
+		t.Error("Response_SaveWithProgress test failed")
+	}
+}
+
+func TestResponse_TeeTo(t *testing.T) {
+	const (
+		payload = "hello world"
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(payload))
+	}))
+	defer ts.Close()
+
+	want := sha256.Sum256([]byte(payload))
+
+	h := sha256.New()
+	client := sreq.New()
+	err := client.
+		Get(ts.URL).
+		EnsureStatusOk().
+		TeeTo(h).
+		Save(testFileName, 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Errorf("Response_TeeTo got: %x, want: %x", got, want)
+	}
+
+	h.Reset()
+	resp := client.Get(ts.URL)
+	data, err := resp.TeeTo(h).Content()
+	if err != nil || string(data) != payload {
+		t.Fatal("Response_TeeTo test failed")
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Errorf("Response_TeeTo got: %x, want: %x", got, want)
+	}
+
+	var buf bytes.Buffer
+	if _, err = resp.TeeTo(&buf).Raw(); err != nil || buf.String() != payload {
+		t.Error("Response_TeeTo test failed")
+	}
+}
+
+func TestResponse_IsJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("t") {
+		case "json":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`{"msg":"hello world"}`))
+		case "problem":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.Write([]byte(`{"title":"not found"}`))
+		case "sniff":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("\n  [1, 2, 3]"))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		}
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	for _, v := range []string{"json", "problem", "sniff"} {
+		resp := client.Get(ts.URL, sreq.WithQuery(sreq.Params{"t": v}))
+		if !resp.IsJSON() || resp.IsXML() {
+			t.Errorf("Response_IsJSON test case %q failed", v)
+		}
+	}
+
+	resp := client.Get(ts.URL, sreq.WithQuery(sreq.Params{"t": "sniff"}))
+	if !resp.IsJSON() {
+		t.Fatal("Response_IsJSON test failed")
+	}
+	var data []int
+	if err := resp.JSON(&data); err != nil || !reflect.DeepEqual(data, []int{1, 2, 3}) {
+		t.Error("Response_IsJSON should not consume the HTTP response body")
+	}
+
+	if client.Get(ts.URL).IsJSON() {
+		t.Error("Response_IsJSON test failed")
+	}
+	if new(sreq.Response).IsJSON() {
+		t.Error("Response_IsJSON test failed")
+	}
+}
+
+func TestResponse_IsXML(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("t") {
+		case "xml":
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			w.Write([]byte(`<msg>hello world</msg>`))
+		case "sniff":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte(`<?xml version="1.0"?><msg>hello world</msg>`))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	for _, v := range []string{"xml", "sniff"} {
+		resp := client.Get(ts.URL, sreq.WithQuery(sreq.Params{"t": v}))
+		if !resp.IsXML() || resp.IsJSON() {
+			t.Errorf("Response_IsXML test case %q failed", v)
+		}
+	}
+
+	if client.Get(ts.URL).IsXML() {
+		t.Error("Response_IsXML test failed")
+	}
+	if new(sreq.Response).IsXML() {
+		t.Error("Response_IsXML test failed")
+	}
+}
+
+func TestResponse_YAML(t *testing.T) {
+	type config struct {
+		Name    string            `yaml:"name"`
+		Port    int               `yaml:"port"`
+		Hosts   []string          `yaml:"hosts"`
+		Labels  map[string]string `yaml:"labels"`
+		Enabled bool              `yaml:"enabled"`
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-yaml" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-yaml")
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	want := config{
+		Name:    "sreq",
+		Port:    8080,
+		Hosts:   []string{"a.example.com", "b.example.com"},
+		Labels:  map[string]string{"env": "test"},
+		Enabled: true,
+	}
+
+	client := sreq.New()
+	resp := client.
+		Post(ts.URL,
+			sreq.WithYAML(want),
+		).
+		EnsureStatusOk()
+
+	var got config
+	if err := resp.YAML(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Response_YAML got: %+v, want: %+v", got, want)
+	}
+
+	var reused config
+	if err := resp.YAML(&reused); err != nil || !reflect.DeepEqual(reused, want) {
+		t.Error("Response_ReuseBody test failed")
+	}
+
+	err := client.
+		Post(ts.URL).
+		EnsureStatusOk().
+		YAML(&got)
+	if err == nil {
+		t.Error("Response_YAML test failed")
+	}
+}
+
+func TestResponse_Msgpack(t *testing.T) {
+	type item struct {
+		ID   int    `msgpack:"id"`
+		Name string `msgpack:"name"`
+	}
+
+	type order struct {
+		No    string            `msgpack:"no"`
+		Items []item            `msgpack:"items"`
+		Meta  map[string]string `msgpack:"meta"`
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/msgpack" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/msgpack")
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	want := order{
+		No: "20191014",
+		Items: []item{
+			{ID: 1, Name: "Fade"},
+			{ID: 2, Name: "Alone"},
+		},
+		Meta: map[string]string{"artist": "Alan Walker"},
+	}
+
+	client := sreq.New()
+	resp := client.
+		Post(ts.URL,
+			sreq.WithMsgpack(want),
+		).
+		EnsureStatusOk()
+
+	var got order
+	if err := resp.Msgpack(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Response_Msgpack got: %+v, want: %+v", got, want)
+	}
+
+	var reused order
+	if err := resp.Msgpack(&reused); err != nil || !reflect.DeepEqual(reused, want) {
+		t.Error("Response_ReuseBody test failed")
+	}
+}
+
+func TestResponse_IsSuccess(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		w.WriteHeader(code)
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	tests := []struct {
+		code        int
+		success     bool
+		clientError bool
+		serverError bool
+	}{
+		{http.StatusNoContent, true, false, false},
+		{http.StatusNotFound, false, true, false},
+		{http.StatusBadGateway, false, false, true},
+	}
+	for _, test := range tests {
+		resp := client.Get(ts.URL, sreq.WithQuery(sreq.Params{
+			"code": test.code,
+		}))
+		if code, err := resp.StatusCode(); err != nil || code != test.code {
+			t.Errorf("Response_StatusCode got: %d, want: %d", code, test.code)
+		}
+		if resp.IsSuccess() != test.success ||
+			resp.IsClientError() != test.clientError ||
+			resp.IsServerError() != test.serverError {
+			t.Errorf("Response_IsSuccess test failed for status code: %d", test.code)
+		}
+		if resp.Err != nil {
+			t.Error("Response_IsSuccess test failed")
+		}
+	}
+
+	resp := &sreq.Response{Err: errors.New("response error")}
+	if code, err := resp.StatusCode(); err == nil || code != 0 {
+		t.Error("Response_StatusCode test failed")
+	}
+	if resp.IsSuccess() || resp.IsClientError() || resp.IsServerError() {
+		t.Error("Response_IsSuccess test failed")
+	}
+
+	resp = new(sreq.Response)
+	if resp.IsSuccess() || resp.IsClientError() || resp.IsServerError() || resp.IsPreconditionFailed() {
+		t.Error("Response_IsSuccess test failed")
+	}
+}
+
+func TestResponse_IsChunked(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("chunked") == "" {
+			w.Header().Set("Content-Length", "11")
+			w.Write([]byte("hello world"))
+			return
+		}
+
+		w.Write([]byte("hello "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("world"))
+	}))
+	defer ts.Close()
+
+	resp := sreq.Get(ts.URL, sreq.WithQuery(sreq.Params{"chunked": 1})).EnsureStatusOk()
+	if data, err := resp.Text(); err != nil || data != "hello world" || !resp.IsChunked() {
+		t.Errorf("Response_IsChunked got: %t, data: %q, want: true", resp.IsChunked(), data)
+	}
+
+	resp = sreq.Get(ts.URL).EnsureStatusOk()
+	if resp.IsChunked() {
+		t.Error("Response_IsChunked got: true, want: false")
+	}
+
+	if new(sreq.Response).IsChunked() {
+		t.Error("Response_IsChunked test failed")
+	}
+}
+
+func TestResponse_RateLimit(t *testing.T) {
+	const date = "Mon, 02 Jan 2006 15:04:05 GMT"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/github":
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "4999")
+			w.Header().Set("X-RateLimit-Reset", "1136214245")
+		case "/delta":
+			w.Header().Set("Date", date)
+			w.Header().Set("RateLimit-Limit", "100")
+			w.Header().Set("RateLimit-Remaining", "0")
+			w.Header().Set("RateLimit-Reset", "60")
+		case "/invalid":
+			w.Header().Set("X-RateLimit-Limit", "many")
+		}
+	}))
+	defer ts.Close()
+
+	base, _ := http.ParseTime(date)
+	tests := []struct {
+		path string
+		want *sreq.RateLimitInfo
+	}{
+		{"/github", &sreq.RateLimitInfo{Limit: 5000, Remaining: 4999, Reset: time.Unix(1136214245, 0)}},
+		{"/delta", &sreq.RateLimitInfo{Limit: 100, Remaining: 0, Reset: base.Add(time.Minute)}},
+	}
+	for _, test := range tests {
+		info, err := sreq.Get(ts.URL + test.path).RateLimit()
+		if err != nil || info.Limit != test.want.Limit || info.Remaining != test.want.Remaining ||
+			!info.Reset.Equal(test.want.Reset) {
+			t.Errorf("Response_RateLimit got: %+v, error: %v, want: %+v", info, err, test.want)
+		}
+	}
+
+	if _, err := sreq.Get(ts.URL).RateLimit(); err != sreq.ErrNoRateLimit {
+		t.Errorf("Response_RateLimit got: %v, want: %v", err, sreq.ErrNoRateLimit)
+	}
+	if _, err := sreq.Get(ts.URL + "/invalid").RateLimit(); err == nil {
+		t.Error("Response_RateLimit test failed")
+	}
+}
+
+func TestResponse_EnsureStatusIn(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == sreq.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	_, err := client.
+		Delete(ts.URL).
+		EnsureStatusIn(http.StatusOK, http.StatusNoContent, http.StatusPartialContent).
+		Raw()
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = client.
+		Put(ts.URL).
+		EnsureStatusIn(http.StatusOK, http.StatusNoContent).
+		Raw()
+	if err == nil || !strings.Contains(err.Error(), "409") || !strings.Contains(err.Error(), "[200 204]") {
+		t.Errorf("Response_EnsureStatusIn got error: %v", err)
+	}
+}
+
+func TestResponse_ClockSkew(t *testing.T) {
+	serverTime := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/nodate" {
+			w.Header()["Date"] = nil
+			return
+		}
+		w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	resp := client.Get(ts.URL)
+	date, ok := resp.Date()
+	if !ok || !date.Equal(serverTime) {
+		t.Errorf("Response_Date got: %v, want: %v", date, serverTime)
+	}
+
+	skew, ok := resp.ClockSkew()
+	if !ok || skew < 58*time.Minute || skew > time.Hour {
+		t.Errorf("Response_ClockSkew got: %s, want about: %s", skew, time.Hour)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if got, _ := resp.ClockSkew(); got != skew {
+		t.Errorf("Response_ClockSkew got: %s, want: %s", got, skew)
+	}
+
+	resp = client.Get(ts.URL + "/nodate")
+	if _, ok = resp.Date(); ok {
+		t.Error("Response_Date test failed")
+	}
+	if _, ok = resp.ClockSkew(); ok {
+		t.Error("Response_ClockSkew test failed")
+	}
+}
+
+func TestResponse_MustJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"msg":"hello world"}`))
+	}))
+	defer ts.Close()
+
+	client := sreq.New()
+	if data := client.Get(ts.URL).MustBytes(); string(data) != `{"msg":"hello world"}` {
+		t.Errorf("Response_MustBytes got: %s, want: %s", data, `{"msg":"hello world"}`)
+	}
+	if data := client.Get(ts.URL).MustText(); data != `{"msg":"hello world"}` {
+		t.Errorf("Response_MustText got: %s, want: %s", data, `{"msg":"hello world"}`)
+	}
+
+	var data struct {
+		Msg string `json:"msg"`
+	}
+	client.Get(ts.URL).MustJSON(&data)
+	if data.Msg != "hello world" {
+		t.Errorf("Response_MustJSON got: %s, want: %s", data.Msg, "hello world")
+	}
+
+	mustPanic := func(name string, fn func(resp *sreq.Response)) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Response_%s should panic", name)
+			}
+		}()
+		fn(client.Get(ts.URL).EnsureStatus(http.StatusNotFound))
+	}
+	mustPanic("MustBytes", func(resp *sreq.Response) { resp.MustBytes() })
+	mustPanic("MustText", func(resp *sreq.Response) { resp.MustText() })
+	mustPanic("MustJSON", func(resp *sreq.Response) { resp.MustJSON(&data) })
+}
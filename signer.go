@@ -0,0 +1,91 @@
+package sreq
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// HMACSigner returns a request signer, used by SetRequestSigner, which signs the HTTP request
+// with HMAC-SHA256 using secret over its canonical string, i.e. the lines of its method, escaped path,
+// sorted query, the signed headers in the form of "name:value" in order, and the hex-encoded SHA256 hash of its payload.
+// The payload hash is set to X-Content-Sha256 header, and the signature is set to Authorization header in the form of
+// "HMAC-SHA256 KeyId=<keyID>, SignedHeaders=<name1;name2>, Signature=<hex-encoded signature>".
+// Notes: The payload must be replayable, otherwise ErrStreamBody will be returned.
+func HMACSigner(keyID string, secret string, headers []string) func(*http.Request) error {
+	signedHeaders := make([]string, len(headers))
+	for i, h := range headers {
+		signedHeaders[i] = strings.ToLower(h)
+	}
+
+	return func(rawRequest *http.Request) error {
+		bodyHash, err := hashBody(rawRequest)
+		if err != nil {
+			return err
+		}
+		rawRequest.Header.Set("X-Content-Sha256", bodyHash)
+
+		var sb strings.Builder
+		sb.WriteString(rawRequest.Method)
+		sb.WriteByte('\n')
+		sb.WriteString(rawRequest.URL.EscapedPath())
+		sb.WriteByte('\n')
+		sb.WriteString(rawRequest.URL.Query().Encode())
+		sb.WriteByte('\n')
+		for _, h := range signedHeaders {
+			sb.WriteString(h)
+			sb.WriteByte(':')
+			sb.WriteString(canonicalHeaderValue(rawRequest, h))
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(bodyHash)
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(sb.String()))
+		rawRequest.Header.Set("Authorization", "HMAC-SHA256 KeyId="+keyID+
+			", SignedHeaders="+strings.Join(signedHeaders, ";")+
+			", Signature="+hex.EncodeToString(mac.Sum(nil)))
+		return nil
+	}
+}
+
+func hashBody(rawRequest *http.Request) (string, error) {
+	h := sha256.New()
+	if rawRequest.Body != nil && rawRequest.Body != http.NoBody {
+		if rawRequest.GetBody == nil {
+			return "", ErrStreamBody
+		}
+
+		rc, err := rawRequest.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+
+		b, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func canonicalHeaderValue(rawRequest *http.Request, name string) string {
+	if name == "host" {
+		if rawRequest.Host != "" {
+			return rawRequest.Host
+		}
+		return rawRequest.URL.Host
+	}
+
+	values := rawRequest.Header[http.CanonicalHeaderKey(name)]
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(trimmed, ",")
+}
@@ -3,15 +3,21 @@ package sreq
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	stdurl "net/url"
 	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 const (
@@ -23,6 +29,23 @@ const (
 
 var (
 	bufPool = &sync.Pool{New: func() interface{} { return &bytes.Buffer{} }}
+
+	// msgpackMarshal and msgpackUnmarshal wrap the MessagePack codec used by sreq,
+	// so that the underlying implementation can be swapped in one place.
+	msgpackMarshal   = msgpack.Marshal
+	msgpackUnmarshal = msgpack.Unmarshal
+
+	// JSONMarshal is the function used by sreq to JSON-encode data, such as the JSON payload of requests.
+	// It defaults to encoding/json without escaping HTML, you can replace it with another implementation,
+	// e.g. jsoniter's Marshal, before making any requests.
+	// sreq does the HTML escaping and indenting on its output itself when required,
+	// notes that HTML can't be left unescaped if the replacement always escapes it.
+	JSONMarshal = marshalJSON
+
+	// JSONUnmarshal is the function used by sreq to JSON-decode data, such as the JSON-encoded responses.
+	// It defaults to encoding/json, decoding the first JSON value of data and ignoring the trailing data,
+	// you can replace it with another implementation, e.g. jsoniter's Unmarshal, before making any requests.
+	JSONUnmarshal = unmarshalJSON
 )
 
 type (
@@ -57,10 +80,16 @@ type (
 	// To upload a file you must specify its Filename field,
 	// otherwise sreq will raise a *RequestError and then abort request.
 	// If you don't specify the MIME field, sreq will detect automatically using http.DetectContentType.
+	// If the Size field of every file is specified, the multipart payload will be sent with Content-Length
+	// rather than chunked, zero means unknown. In that case, if every file is opened by Open, MustOpen
+	// or FilesFromDir, the payload can be sent again, i.e. the request can be retried and redirected.
 	File struct {
 		Filename string
 		Body     io.Reader
 		MIME     string
+		Size     int64
+
+		path string
 	}
 
 	// H is a shortcut for map[string]interface{}, used for JSON unmarshalling.
@@ -119,6 +148,14 @@ func (v Values) Encode() string {
 	return sb.String()
 }
 
+// EncodeEscaped encodes v into URL-escaped form sorted by key,
+// it's identical to the output of url.Values.Encode.
+func (v Values) EncodeEscaped() string {
+	var sb strings.Builder
+	write(&sb, v, writeEscapedValues)
+	return sb.String()
+}
+
 // String returns the text representation of v.
 func (v Values) String() string {
 	return v.Encode()
@@ -419,6 +456,12 @@ func (f *File) SetMIME(mime string) *File {
 	return f
 }
 
+// SetSize sets Size field value of f, i.e. the number of bytes of its body.
+func (f *File) SetSize(n int64) *File {
+	f.Size = n
+	return f
+}
+
 // Read implements Reader interface.
 func (f *File) Read(p []byte) (int, error) {
 	if f.Body == nil {
@@ -447,7 +490,9 @@ func Open(filename string) (*File, error) {
 		return nil, err
 	}
 
-	return NewFile(filename, file), nil
+	f := NewFile(filename, file)
+	f.path = filename
+	return f, nil
 }
 
 // MustOpen opens the named file and returns a *File instance whose Filename is filename.
@@ -461,6 +506,38 @@ func MustOpen(filename string) *File {
 	return file
 }
 
+// FilesFromDir opens every regular file in the named directory and returns a Files instance
+// keyed by fieldPrefix followed by the file name, whose Filename and Size are specified.
+// Subdirectories are skipped. The files will be closed once they're sent as the multipart payload,
+// otherwise the caller is responsible for closing them.
+func FilesFromDir(fieldPrefix string, dir string) (Files, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(Files, len(infos))
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		path := filepath.Join(dir, info.Name())
+		file, err := os.Open(path)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		f := NewFile(info.Name(), file).SetSize(info.Size())
+		f.path = path
+		files[fieldPrefix+info.Name()] = f
+	}
+
+	return files, nil
+}
+
 func convertIntArray(v []int) []string {
 	vs := make([]string, len(v))
 	for i, vv := range v {
@@ -510,6 +587,18 @@ func writeValues(sb *strings.Builder, k string, v []string) {
 	}
 }
 
+func writeEscapedValues(sb *strings.Builder, k string, v []string) {
+	k = stdurl.QueryEscape(k)
+	for _, vs := range v {
+		if sb.Len() > 0 {
+			sb.WriteString("&")
+		}
+		sb.WriteString(k)
+		sb.WriteString("=")
+		sb.WriteString(stdurl.QueryEscape(vs))
+	}
+}
+
 func writeHeaders(sb *strings.Builder, k string, v []string) {
 	for _, vs := range v {
 		if sb.Len() > 0 {
@@ -538,13 +627,251 @@ func toJSON(data interface{}) string {
 	return string(b)
 }
 
-func jsonMarshal(v interface{}, prefix string, indent string, escapeHTML bool) ([]byte, error) {
+func marshalJSON(v interface{}) ([]byte, error) {
 	buf := acquireBuffer()
 	defer releaseBuffer(buf)
 
 	encoder := json.NewEncoder(buf)
-	encoder.SetIndent(prefix, indent)
-	encoder.SetEscapeHTML(escapeHTML)
+	encoder.SetEscapeHTML(false)
 	err := encoder.Encode(v)
-	return buf.Bytes(), err
+	if err != nil {
+		return nil, err
+	}
+
+	b := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	return append([]byte(nil), b...), nil
+}
+
+func unmarshalJSON(data []byte, v interface{}) error {
+	return json.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// jsonMarshal JSON-encodes v using JSONMarshal, with the HTML escaping and indenting applied,
+// the output is terminated by a newline like json.Encoder does.
+func jsonMarshal(v interface{}, prefix string, indent string, escapeHTML bool) ([]byte, error) {
+	b, err := JSONMarshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if escapeHTML {
+		json.HTMLEscape(&buf, b)
+		b = append([]byte(nil), buf.Bytes()...)
+		buf.Reset()
+	}
+	if prefix != "" || indent != "" {
+		if err = json.Indent(&buf, b, prefix, indent); err != nil {
+			return nil, err
+		}
+		b = append([]byte(nil), buf.Bytes()...)
+	}
+	return append(b, '\n'), nil
+}
+
+// structToValues converts a struct or a pointer to struct into Values,
+// using the first present tag in tags as the key of each field, or the field name if none.
+// A tag of "-" skips the field, the "omitempty" option skips the field if it has a zero value.
+func structToValues(v interface{}, tags ...string) (Values, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return Values{}, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported type %T, want a struct or a pointer to struct", v)
+	}
+
+	values := make(Values)
+	err := reflectStruct(values, rv, tags)
+	return values, err
+}
+
+func reflectStruct(values Values, rv reflect.Value, tags []string) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		tag := ""
+		for _, t := range tags {
+			if tag = sf.Tag.Get(t); tag != "" {
+				break
+			}
+		}
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx != -1 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		omitEmpty := strings.Contains(","+opts+",", ",omitempty,")
+
+		fv := rv.Field(i)
+		if omitEmpty && isZeroValue(fv) {
+			continue
+		}
+		for fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Ptr {
+			continue
+		}
+
+		if sf.Anonymous && name == "" && fv.Kind() == reflect.Struct {
+			if err := reflectStruct(values, fv, tags); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		var vs []string
+		switch fv.Kind() {
+		case reflect.Slice, reflect.Array:
+			if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8 {
+				vs = []string{string(fv.Bytes())}
+				break
+			}
+
+			vs = make([]string, 0, fv.Len())
+			for j := 0; j < fv.Len(); j++ {
+				s, err := formatValue(fv.Index(j))
+				if err != nil {
+					return fmt.Errorf("field %s: %s", sf.Name, err)
+				}
+				vs = append(vs, s)
+			}
+		default:
+			s, err := formatValue(fv)
+			if err != nil {
+				return fmt.Errorf("field %s: %s", sf.Name, err)
+			}
+			vs = []string{s}
+		}
+		values[name] = vs
+	}
+
+	return nil
+}
+
+func formatValue(rv reflect.Value) (string, error) {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return "", nil
+		}
+		rv = rv.Elem()
+	}
+
+	if t, ok := rv.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
+	default:
+		if s, ok := rv.Interface().(fmt.Stringer); ok {
+			return s.String(), nil
+		}
+		return "", fmt.Errorf("unsupported type %s", rv.Type())
+	}
+}
+
+func isZeroValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	case reflect.Struct:
+		if t, ok := rv.Interface().(time.Time); ok {
+			return t.IsZero()
+		}
+	}
+	return false
+}
+
+// relaxJSON strips comments and trailing commas from b,
+// so that it can be decoded by the standard JSON decoder.
+func relaxJSON(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	comma := -1
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == '"':
+			j := i + 1
+			for ; j < len(b) && b[j] != '"'; j++ {
+				if b[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(b) {
+				j = len(b) - 1
+			}
+			out = append(out, b[i:j+1]...)
+			i = j
+			comma = -1
+		case c == '/' && i+1 < len(b) && b[i+1] == '/':
+			for i < len(b) && b[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '/' && i+1 < len(b) && b[i+1] == '*':
+			j := bytes.Index(b[i+2:], []byte("*/"))
+			if j < 0 {
+				// Leave the unterminated comment to the decoder to report.
+				return append(out, b[i:]...)
+			}
+			out = append(out, ' ')
+			i += j + 3
+		case c == ',':
+			comma = len(out)
+			out = append(out, c)
+		case c == '}' || c == ']':
+			if comma >= 0 {
+				out = append(out[:comma], out[comma+1:]...)
+				comma = -1
+			}
+			out = append(out, c)
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			out = append(out, c)
+		default:
+			comma = -1
+			out = append(out, c)
+		}
+	}
+
+	return out
 }
@@ -4,11 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -114,6 +120,24 @@ func TestValues(t *testing.T) {
 	}
 }
 
+func TestValues_EncodeEscaped(t *testing.T) {
+	v := sreq.Values{
+		"q":        "go & sreq",
+		"lang":     []string{"en-US", "zh/CN"},
+		"page num": 1,
+		"emoji":    "☺",
+	}
+	want := url.Values{
+		"q":        {"go & sreq"},
+		"lang":     {"en-US", "zh/CN"},
+		"page num": {"1"},
+		"emoji":    {"☺"},
+	}.Encode()
+	if got := v.EncodeEscaped(); got != want {
+		t.Errorf("Values_EncodeEscaped got: %q, want: %q", got, want)
+	}
+}
+
 func TestHeaders(t *testing.T) {
 	var h sreq.Headers
 	if h.Get("key") != nil {
@@ -209,6 +233,149 @@ func TestOpen(t *testing.T) {
 	}
 }
 
+func TestFile_SetSize(t *testing.T) {
+	type result struct {
+		contentLength    int64
+		transferEncoding []string
+		content          string
+	}
+	results := make(chan result, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(32 << 20)
+		var content string
+		if file, _, err := r.FormFile("file"); err == nil {
+			b, _ := ioutil.ReadAll(file)
+			content = string(b)
+		}
+		results <- result{r.ContentLength, r.TransferEncoding, content + r.FormValue("k")}
+	}))
+	defer ts.Close()
+
+	const data = "hello world"
+	files := sreq.Files{
+		"file": sreq.NewFile("hello.txt", strings.NewReader(data)).SetSize(int64(len(data))),
+	}
+	err := sreq.Post(ts.URL, sreq.WithMultipart(files, sreq.Form{"k": "v"})).Error()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := <-results
+	if res.contentLength <= int64(len(data)) || len(res.transferEncoding) != 0 || res.content != data+"v" {
+		t.Errorf("File_SetSize got Content-Length: %d, Transfer-Encoding: %v, content: %q",
+			res.contentLength, res.transferEncoding, res.content)
+	}
+
+	files = sreq.Files{
+		"file": sreq.NewFile("hello.txt", strings.NewReader(data)),
+	}
+	err = sreq.Post(ts.URL, sreq.WithMultipart(files, sreq.Form{"k": "v"})).Error()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = <-results
+	if res.contentLength != -1 || len(res.transferEncoding) == 0 || res.content != data+"v" {
+		t.Errorf("File_SetSize got Content-Length: %d, Transfer-Encoding: %v, content: %q, want chunked",
+			res.contentLength, res.transferEncoding, res.content)
+	}
+
+	err = sreq.Post(ts.URL, sreq.WithMultipart(nil, sreq.Form{"k": "v"})).Error()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = <-results
+	if res.contentLength <= 0 || len(res.transferEncoding) != 0 || res.content != "v" {
+		t.Errorf("File_SetSize got Content-Length: %d, Transfer-Encoding: %v, content: %q",
+			res.contentLength, res.transferEncoding, res.content)
+	}
+}
+
+func TestFilesFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sreq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := map[string]string{
+		"file_a.txt": "hello",
+		"file_b.txt": "world",
+	}
+	for name, content := range map[string]string{"a.txt": "hello", "b.txt": "world"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := sreq.FilesFromDir("file_", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(want) {
+		t.Fatalf("FilesFromDir got %d files, want: %d", len(files), len(want))
+	}
+
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		case "/retry":
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				io.Copy(ioutil.Discard, r.Body)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got := make(map[string]string)
+		for field, headers := range r.MultipartForm.File {
+			f, err := headers[0].Open()
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			b, _ := ioutil.ReadAll(f)
+			f.Close()
+			got[field] = string(b)
+		}
+		if !reflect.DeepEqual(got, want) || r.ContentLength <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	err = sreq.Post(ts.URL, sreq.WithMultipart(files, nil)).EnsureStatusOk().Error()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// The files opened by FilesFromDir can be sent again.
+	client := sreq.New().SetRetry(2, 10*time.Millisecond, func(resp *sreq.Response) bool {
+		return resp.Err != nil || resp.RawResponse.StatusCode == http.StatusInternalServerError
+	})
+	for _, path := range []string{"/redirect", "/retry"} {
+		files, err = sreq.FilesFromDir("file_", dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.Post(ts.URL+path, sreq.WithMultipart(files, nil)).EnsureStatusOk().Error()
+		if err != nil {
+			t.Errorf("FilesFromDir got error: %v for %s", err, path)
+		}
+	}
+
+	if _, err = sreq.FilesFromDir("file_", filepath.Join(dir, "not_exist")); err == nil {
+		t.Error("FilesFromDir test failed")
+	}
+}
+
 func TestH(t *testing.T) {
 	var (
 		boolSlice            = []bool{true, false}
@@ -302,3 +469,80 @@ func TestH(t *testing.T) {
 		t.Errorf("H_string got: %q, want: %q", got, want)
 	}
 }
+
+func TestJSONCodec(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	var marshalCalls, unmarshalCalls int
+	marshal, unmarshal := sreq.JSONMarshal, sreq.JSONUnmarshal
+	defer func() {
+		sreq.JSONMarshal, sreq.JSONUnmarshal = marshal, unmarshal
+	}()
+	sreq.JSONMarshal = func(v interface{}) ([]byte, error) {
+		marshalCalls++
+		return marshal(v)
+	}
+	sreq.JSONUnmarshal = func(data []byte, v interface{}) error {
+		unmarshalCalls++
+		return unmarshal(data, v)
+	}
+
+	client := sreq.New()
+	resp := client.Post(ts.URL,
+		sreq.WithJSON(map[string]interface{}{
+			"msg": "hi&hello",
+		}, false),
+	)
+	data, err := resp.Text()
+	if want := "{\"msg\":\"hi&hello\"}\n"; err != nil || data != want {
+		t.Errorf("JSONCodec got: %q, want: %q", data, want)
+	}
+
+	h, err := resp.H()
+	if err != nil || h.GetString("msg") != "hi&hello" {
+		t.Error("JSONCodec test failed")
+	}
+
+	data, err = client.
+		Post(ts.URL,
+			sreq.WithJSON(map[string]interface{}{
+				"msg": "hi&hello",
+			}, true),
+		).
+		Text()
+	if want := "{\"msg\":\"hi\\u0026hello\"}\n"; err != nil || data != want {
+		t.Errorf("JSONCodec got: %q, want: %q", data, want)
+	}
+
+	if marshalCalls != 2 || unmarshalCalls != 1 {
+		t.Errorf("JSONCodec got calls: (%d, %d), want: (%d, %d)", marshalCalls, unmarshalCalls, 2, 1)
+	}
+
+	sreq.JSONMarshal, sreq.JSONUnmarshal = json.Marshal, json.Unmarshal
+	data, err = client.
+		Post(ts.URL,
+			sreq.WithJSON(map[string]interface{}{
+				"msg": "hi&hello",
+			}, true),
+		).
+		Text()
+	if want := "{\"msg\":\"hi\\u0026hello\"}\n"; err != nil || data != want {
+		t.Errorf("JSONCodec got: %q, want: %q", data, want)
+	}
+}
+
+func TestResponse_JSONTrailingData(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"msg":"hi"}` + "\n" + `{"msg":"hello"}`))
+	}))
+	defer ts.Close()
+
+	h, err := sreq.Get(ts.URL).H()
+	if err != nil || h.GetString("msg") != "hi" {
+		t.Errorf("Response_JSON got: %v, error: %v, want the first JSON value", h, err)
+	}
+}
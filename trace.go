@@ -0,0 +1,110 @@
+package sreq
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+type (
+	// TraceInfo records the timing metrics of an HTTP request.
+	// DNSLookup, TCPConnect and TLSHandshake are zero if a connection is reused.
+	TraceInfo struct {
+		DNSLookup        time.Duration
+		TCPConnect       time.Duration
+		TLSHandshake     time.Duration
+		ServerProcessing time.Duration
+		TotalTime        time.Duration
+	}
+
+	clientTrace struct {
+		mu           sync.Mutex
+		start        time.Time
+		dnsStart     time.Time
+		dnsDone      time.Time
+		connectStart time.Time
+		connectDone  time.Time
+		tlsStart     time.Time
+		tlsDone      time.Time
+		wroteRequest time.Time
+		firstByte    time.Time
+		end          time.Time
+	}
+)
+
+func (ct *clientTrace) record(t *time.Time) {
+	ct.mu.Lock()
+	*t = time.Now()
+	ct.mu.Unlock()
+}
+
+func (ct *clientTrace) reset() {
+	ct.mu.Lock()
+	ct.dnsStart, ct.dnsDone = time.Time{}, time.Time{}
+	ct.connectStart, ct.connectDone = time.Time{}, time.Time{}
+	ct.tlsStart, ct.tlsDone = time.Time{}, time.Time{}
+	ct.wroteRequest, ct.firstByte, ct.end = time.Time{}, time.Time{}, time.Time{}
+	ct.start = time.Now()
+	ct.mu.Unlock()
+}
+
+func (ct *clientTrace) done() {
+	ct.record(&ct.end)
+}
+
+func (ct *clientTrace) withContext(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(_ httptrace.DNSStartInfo) {
+			ct.record(&ct.dnsStart)
+		},
+		DNSDone: func(_ httptrace.DNSDoneInfo) {
+			ct.record(&ct.dnsDone)
+		},
+		ConnectStart: func(_, _ string) {
+			ct.mu.Lock()
+			if ct.connectStart.IsZero() {
+				ct.connectStart = time.Now()
+			}
+			ct.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				ct.record(&ct.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() {
+			ct.record(&ct.tlsStart)
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, _ error) {
+			ct.record(&ct.tlsDone)
+		},
+		WroteRequest: func(_ httptrace.WroteRequestInfo) {
+			ct.record(&ct.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			ct.record(&ct.firstByte)
+		},
+	})
+}
+
+func (ct *clientTrace) info() *TraceInfo {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	return &TraceInfo{
+		DNSLookup:        since(ct.dnsStart, ct.dnsDone),
+		TCPConnect:       since(ct.connectStart, ct.connectDone),
+		TLSHandshake:     since(ct.tlsStart, ct.tlsDone),
+		ServerProcessing: since(ct.wroteRequest, ct.firstByte),
+		TotalTime:        since(ct.start, ct.end),
+	}
+}
+
+func since(start time.Time, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
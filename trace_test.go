@@ -0,0 +1,46 @@
+package sreq_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/winterssy/sreq"
+)
+
+func TestWithTrace(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	client := sreq.New().DisableVerify()
+	resp := client.Get(ts.URL)
+	if resp.Trace() != nil {
+		t.Error("Trace should be nil if not enabled")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	resp = client.
+		Get(ts.URL,
+			sreq.WithTrace(),
+			sreq.WithContext(ctx),
+		).
+		EnsureStatusOk()
+	if _, err := resp.Raw(); err != nil {
+		t.Fatal(err)
+	}
+
+	info := resp.Trace()
+	if info == nil {
+		t.Fatal("WithTrace test failed")
+	}
+	if info.TCPConnect <= 0 || info.TLSHandshake <= 0 ||
+		info.ServerProcessing < 10*time.Millisecond || info.TotalTime < info.ServerProcessing {
+		t.Errorf("WithTrace test failed: %+v", info)
+	}
+}
@@ -24,3 +24,11 @@ func DefaultTransport() *http.Transport {
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 }
+
+func setWriteBufferSize(_ *http.Transport, _ int) error {
+	return ErrUnsupportedTransportField
+}
+
+func setReadBufferSize(_ *http.Transport, _ int) error {
+	return ErrUnsupportedTransportField
+}
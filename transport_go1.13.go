@@ -24,3 +24,13 @@ func DefaultTransport() *http.Transport {
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 }
+
+func setWriteBufferSize(t *http.Transport, n int) error {
+	t.WriteBufferSize = n
+	return nil
+}
+
+func setReadBufferSize(t *http.Transport, n int) error {
+	t.ReadBufferSize = n
+	return nil
+}